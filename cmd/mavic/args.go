@@ -0,0 +1,137 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+// defaultCommand is the command run when no command is given, keeping the
+// original "mavic [flags] subreddits..." form working.
+const defaultCommand = "download"
+
+// builtinAppFlags are the flags added to the application by the cli tools, which
+// only exist once the application is running.
+var builtinAppFlags = map[string]bool{"help": true, "h": true, "version": true, "v": true}
+
+// normalizeArgs reorders the command line arguments so flags can be given in any
+// position, since the cli tools stop parsing flags at the first argument. The
+// flags of the application are moved before the command, the flags of the command
+// directly after it and the arguments last. When no command is given the default
+// command is used, unless the help or version of the application was asked for.
+func normalizeArgs(app *cli.App, args []string) []string {
+	if len(args) == 0 {
+		return args
+	}
+
+	var global, flags, arguments []string
+	var command *cli.Command
+	var commandName string
+	terminated := false
+
+	for i := 1; i < len(args); i++ {
+		arg := args[i]
+
+		if terminated || arg == "-" || !strings.HasPrefix(arg, "-") {
+			if commandName == "" && len(arguments) == 0 && !terminated {
+				// the help command only exists once the application is running.
+				if arg == "help" || arg == "h" {
+					return args
+				}
+
+				if command = app.Command(arg); command != nil {
+					commandName = arg
+					continue
+				}
+			}
+
+			arguments = append(arguments, arg)
+			continue
+		}
+
+		if arg == "--" {
+			terminated = true
+			continue
+		}
+
+		name := strings.TrimLeft(arg, "-")
+
+		if index := strings.Index(name, "="); index >= 0 {
+			name = name[:index]
+		}
+
+		values := []string{arg}
+
+		if !strings.Contains(arg, "=") && i+1 < len(args) && takesValue(app, command, name) {
+			values = append(values, args[i+1])
+			i++
+		}
+
+		// the help flag given after the command is the help of the command.
+		isGlobal := findFlag(app.Flags, name) != nil || (command == nil && builtinAppFlags[name])
+
+		if isGlobal && (command == nil || findFlag(command.Flags, name) == nil) {
+			global = append(global, values...)
+		} else {
+			flags = append(flags, values...)
+		}
+	}
+
+	if commandName == "" {
+		for _, arg := range global {
+			if builtinAppFlags[strings.TrimLeft(arg, "-")] && len(flags) == 0 && len(arguments) == 0 {
+				return append([]string{args[0]}, global...)
+			}
+		}
+
+		commandName = defaultCommand
+	}
+
+	normalized := append([]string{args[0]}, global...)
+	normalized = append(normalized, commandName)
+	normalized = append(normalized, flags...)
+
+	// arguments starting with a dash must not be parsed as flags.
+	for _, arg := range arguments {
+		if strings.HasPrefix(arg, "-") {
+			normalized = append(normalized, "--")
+			break
+		}
+	}
+
+	return append(normalized, arguments...)
+}
+
+// takesValue returns true if the flag of the given name is followed by its value,
+// looking through every command when the command is not yet known.
+func takesValue(app *cli.App, command *cli.Command, name string) bool {
+	flag := findFlag(app.Flags, name)
+
+	if flag == nil && command != nil {
+		flag = findFlag(command.Flags, name)
+	}
+
+	for i := 0; flag == nil && command == nil && i < len(app.Commands); i++ {
+		flag = findFlag(app.Commands[i].Flags, name)
+	}
+
+	if flag == nil {
+		return false
+	}
+
+	_, isBool := flag.(*cli.BoolFlag)
+	return !isBool
+}
+
+// findFlag returns the flag with the given name (or alias), nil if not found.
+func findFlag(flags []cli.Flag, name string) cli.Flag {
+	for _, flag := range flags {
+		for _, flagName := range flag.Names() {
+			if flagName == name {
+				return flag
+			}
+		}
+	}
+
+	return nil
+}
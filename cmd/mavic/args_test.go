@@ -0,0 +1,41 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestNormalizeArgs ensures flags are accepted in any position, the default
+// command is used when no command is given and the help is left as is.
+func TestNormalizeArgs(t *testing.T) {
+	setupApplicationFlags()
+	setupApplicationCommands()
+
+	cases := []struct {
+		args     []string
+		expected []string
+	}{
+		{args: []string{"mavic", "download", "cute", "-l", "10", "pics"},
+			expected: []string{"mavic", "download", "-l", "10", "cute", "pics"}},
+		{args: []string{"mavic", "-l", "10", "-f", "cute"},
+			expected: []string{"mavic", "download", "-l", "10", "-f", "cute"}},
+		{args: []string{"mavic", "watch", "cute", "--profile", "memes", "--interval=1m", "-c", "config.yaml"},
+			expected: []string{"mavic", "--profile", "memes", "-c", "config.yaml", "watch", "--interval=1m", "cute"}},
+		{args: []string{"mavic", "list", "cute", "--", "-odd"},
+			expected: []string{"mavic", "list", "--", "cute", "-odd"}},
+		{args: []string{"mavic", "gallery", "./pictures", "-o", "./out"},
+			expected: []string{"mavic", "gallery", "-o", "./out", "./pictures"}},
+		{args: []string{"mavic", "verify", "./pictures", "--proxy", "socks5://host:1080", "--fix"},
+			expected: []string{"mavic", "verify", "--proxy", "socks5://host:1080", "--fix", "./pictures"}},
+		{args: []string{"mavic", "download", "--help"},
+			expected: []string{"mavic", "download", "--help"}},
+		{args: []string{"mavic", "--help"}, expected: []string{"mavic", "--help"}},
+		{args: []string{"mavic", "help", "watch"}, expected: []string{"mavic", "help", "watch"}},
+		{args: []string{"mavic"}, expected: []string{"mavic", "download"}},
+	}
+
+	for _, c := range cases {
+		assert.Equal(t, c.expected, normalizeArgs(app, c.args), c.args)
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/stephensli/mavic/internal/config"
+	"github.com/urfave/cli/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// subredditsKey is the config key of the sub reddits to scrape, which are given
+// as arguments over a flag on the command line.
+const subredditsKey = "subreddits"
+
+// unsupportedConfigKeys are the flags that cannot be set from the config file.
+var unsupportedConfigKeys = map[string]bool{"config": true, "profile": true, "help": true, "version": true}
+
+// loadConfig loads the option values of the config file and the selected profile,
+// returning a empty path when there is no config file. The config file is given
+// with --config, otherwise discovered within the XDG config directory.
+func loadConfig(c *cli.Context) (string, config.File, config.Values, error) {
+	path := c.String("config")
+
+	if path == "" {
+		path = config.Discover()
+	}
+
+	profile := c.String("profile")
+
+	if path == "" {
+		if profile != "" {
+			return "", config.File{}, nil, cli.Exit(fmt.Sprintf("profile '%v' was given but no config file was found at %v",
+				profile, config.DefaultPath()), exitCodeUsage)
+		}
+
+		return "", config.File{}, nil, nil
+	}
+
+	file, err := config.Load(path)
+
+	if err != nil {
+		return "", config.File{}, nil, cli.Exit(fmt.Sprintf("failed to load config: %v", err), exitCodeUsage)
+	}
+
+	values, err := file.Profile(profile)
+
+	if err != nil {
+		return "", config.File{}, nil, cli.Exit(fmt.Sprintf("failed to load config %v: %v", path, err), exitCodeUsage)
+	}
+
+	return path, file, values, nil
+}
+
+// applyConfig applies the option values of the config file (and the selected
+// profile) for every flag of the command that was not given on the command line
+// or through the environment, so the command line always takes precedence. The
+// options of other commands (e.g the interval of watch) are ignored, allowing a
+// single config file to be shared by every command.
+func applyConfig(c *cli.Context) error {
+	return applyConfigFlags(c, c.Command.Flags)
+}
+
+// applyConfigFlags applies the option values of the config file for only the
+// given flags of the command, the option values of the other flags are ignored.
+func applyConfigFlags(c *cli.Context, flags []cli.Flag) error {
+	path, _, values, err := loadConfig(c)
+
+	if err != nil || path == "" {
+		return err
+	}
+
+	// flags can be referenced by any of their names, but are always set by the
+	// primary name to ensure the command line is correctly detected.
+	flagNames := map[string]string{}
+	knownNames := map[string]bool{}
+
+	for _, command := range c.App.Commands {
+		for _, flag := range command.Flags {
+			for _, name := range flag.Names() {
+				knownNames[name] = true
+			}
+		}
+	}
+
+	for _, flag := range flags {
+		for _, name := range flag.Names() {
+			flagNames[name] = flag.Names()[0]
+		}
+	}
+
+	for _, key := range values.Keys() {
+		if key == subredditsKey {
+			targets, err := values.Targets(key)
+
+			if err != nil {
+				return cli.Exit(fmt.Sprintf("invalid subreddits in config %v: %v", path, err), exitCodeUsage)
+			}
+
+			if c.Args().Len() == 0 {
+				options.Subreddits = targets
+			}
+
+			continue
+		}
+
+		if unsupportedConfigKeys[key] || !knownNames[key] {
+			return cli.Exit(fmt.Sprintf("unknown option '%v' in config %v", key, path), exitCodeUsage)
+		}
+
+		name, ok := flagNames[key]
+
+		if !ok || c.IsSet(name) {
+			continue
+		}
+
+		for _, value := range values.Strings(key) {
+			if err := c.Set(name, value); err != nil {
+				return cli.Exit(fmt.Sprintf("invalid value '%v' for option '%v' in config %v: %v",
+					value, key, path, err), exitCodeUsage)
+			}
+		}
+	}
+
+	return nil
+}
+
+// showConfig is called by the cli control when the config command is used,
+// printing the path of the config file, the option values applied to every run
+// with the selected profile and the names of the profiles.
+func showConfig(c *cli.Context) error {
+	path, file, values, err := loadConfig(c)
+
+	if err != nil {
+		return err
+	}
+
+	if path == "" {
+		fmt.Printf("no config file was found at %v\n", config.DefaultPath())
+		return nil
+	}
+
+	output, err := yaml.Marshal(values)
+
+	if err != nil {
+		return cli.Exit(fmt.Sprintf("failed to show config %v: %v", path, err), exitCodeFailure)
+	}
+
+	profiles := make([]string, 0, len(file.Profiles))
+
+	for name := range file.Profiles {
+		profiles = append(profiles, name)
+	}
+
+	sort.Strings(profiles)
+
+	if profile := c.String("profile"); profile != "" {
+		fmt.Printf("# %v (profile %v)\n", path, profile)
+	} else {
+		fmt.Printf("# %v\n", path)
+	}
+
+	fmt.Print(string(output))
+
+	if len(profiles) > 0 {
+		fmt.Printf("# profiles: %v\n", strings.Join(profiles, ", "))
+	}
+
+	return nil
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"time"
+
+	"github.com/stephensli/mavic/internal/logging"
+	"github.com/stephensli/mavic/internal/scraper"
+	"github.com/urfave/cli/v2"
+)
+
+// globalFlags are the flags of the application, shared by every command.
+func globalFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:    "config",
+			Aliases: []string{"c"},
+			Usage:   "The yaml config file the options are loaded from, flags take precedence. (default: $XDG_CONFIG_HOME/mavic/config.yaml)",
+			EnvVars: []string{"MAVIC_CONFIG"},
+		},
+		&cli.StringFlag{
+			Name:    "profile",
+			Usage:   "The named profile within the config file to use, overriding the options of the config file.",
+			EnvVars: []string{"MAVIC_PROFILE"},
+		},
+	}
+}
+
+// scrapeFlags are the flags of the commands that scrape reddit (download, watch
+// and list), each command gets its own flags all bound to the same options.
+func scrapeFlags() []cli.Flag {
+	return append([]cli.Flag{
+		&cli.StringFlag{
+			Name:        "output",
+			Aliases:     []string{"o"},
+			Usage:       "The output directory to store the images.",
+			Value:       "./",
+			Destination: &options.OutputDirectory,
+		}, &cli.IntFlag{
+			Name:        "limit",
+			Aliases:     []string{"l"},
+			Usage:       "The total number of posts max per sub-reddit (up to 500)",
+			Value:       50,
+			Destination: &options.ImageLimit,
+		},
+		&cli.BoolFlag{
+			Name:        "frontpage",
+			Aliases:     []string{"f"},
+			Usage:       "If the front page should be scrapped or not.",
+			Destination: &options.FrontPage,
+		},
+		&cli.BoolFlag{
+			Name:        "saved",
+			Usage:       "If the saved posts of the authenticated user should be scrapped, requires the username and password.",
+			Destination: &options.Saved,
+		},
+		&cli.BoolFlag{
+			Name:        "upvoted",
+			Usage:       "If the upvoted posts of the authenticated user should be scrapped, requires the username and password.",
+			Destination: &options.Upvoted,
+		},
+		&cli.StringFlag{
+			Name:        "type",
+			Aliases:     []string{"t"},
+			Usage:       "What kind of page type should reddit be during the scrapping process. e.g hot, new. top.",
+			Value:       "hot",
+			Destination: &options.PageType,
+		},
+		&cli.BoolFlag{
+			Name:        "root",
+			Aliases:     []string{"r"},
+			Usage:       "If specified, downloads the images directly into the root, not the subreddit folder.",
+			Destination: &options.RootFolderOnly,
+		},
+		&cli.BoolFlag{
+			Name:        "progressBar",
+			Aliases:     []string{"p"},
+			Usage:       "If the progress bar should be displayed or not.",
+			Value:       false,
+			Destination: &options.DisplayLoading,
+		},
+		&cli.StringFlag{
+			Name:  "log-level",
+			Usage: "The level of the events logged to stderr: debug, info, warn or error. (default: info, warn with the progress bar)",
+		},
+		&cli.StringFlag{
+			Name:  "log-format",
+			Usage: "The format of the events logged to stderr: text or json (a json object per line).",
+			Value: logging.FormatText,
+		},
+		&cli.BoolFlag{
+			Name:        "metadata",
+			Aliases:     []string{"m"},
+			Usage:       "If the post title, author, subreddit and link should be embedded into the downloaded files.",
+			Destination: &options.EmbedMetadata,
+		},
+		&cli.StringFlag{
+			Name:        "report",
+			Usage:       "Writes a report of every processed item to the given path, e.g report.json or report.csv.",
+			Destination: &options.ReportPath,
+		},
+		&cli.IntFlag{
+			Name:        "thumbnails",
+			Usage:       "Generates thumbnails of the given max dimension into a .thumbs folder, 0 disables thumbnails.",
+			Value:       0,
+			Destination: &options.ThumbnailSize,
+		},
+		&cli.StringFlag{
+			Name:        "archive",
+			Usage:       "Writes the images directly into the given archive over the output directory, e.g out.zip or out.tar.gz.",
+			Destination: &options.ArchivePath,
+		},
+		&cli.IntFlag{
+			Name:        "retries",
+			Usage:       "The max number of attempts for a request that fails with a transient error (e.g timeouts, 429 or 5xx).",
+			Value:       3,
+			Destination: &options.RetryAttempts,
+		},
+		&cli.DurationFlag{
+			Name:        "retry-delay",
+			Usage:       "The delay before the first retry, doubling on each attempt after unless the server asks for longer.",
+			Value:       time.Second,
+			Destination: &options.RetryDelay,
+		},
+		&cli.StringFlag{
+			Name:        "client-id",
+			Usage:       "The client id of the reddit application, enables access through the reddit oauth api.",
+			EnvVars:     []string{"MAVIC_CLIENT_ID"},
+			Destination: &options.Credentials.ClientID,
+		},
+		&cli.StringFlag{
+			Name:        "client-secret",
+			Usage:       "The client secret of the reddit application.",
+			EnvVars:     []string{"MAVIC_CLIENT_SECRET"},
+			Destination: &options.Credentials.ClientSecret,
+		},
+		&cli.StringFlag{
+			Name:        "username",
+			Usage:       "The reddit username, only for script applications.",
+			EnvVars:     []string{"MAVIC_USERNAME"},
+			Destination: &options.Credentials.Username,
+		},
+		&cli.StringFlag{
+			Name:        "password",
+			Usage:       "The reddit password, only for script applications.",
+			EnvVars:     []string{"MAVIC_PASSWORD"},
+			Destination: &options.Credentials.Password,
+		},
+		&cli.StringFlag{
+			Name:    "credentials",
+			Usage:   "A json file containing the clientId, clientSecret, username and password, flags take precedence.",
+			EnvVars: []string{"MAVIC_CREDENTIALS"},
+		},
+	}, connectionFlags()...)
+}
+
+// connectionFlags configure the client every request is made with, shared by the
+// commands that scrape reddit and verify (which downloads broken images again).
+func connectionFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.DurationFlag{
+			Name:        "connect-timeout",
+			Usage:       "How long to wait for a connection to be established, 0 waits for as long as the system allows.",
+			Value:       30 * time.Second,
+			Destination: &options.ConnectTimeout,
+		},
+		&cli.DurationFlag{
+			Name:        "read-timeout",
+			Usage:       "How long a response can go without receiving any data before failing, 0 never times out.",
+			Value:       time.Minute,
+			Destination: &options.ReadTimeout,
+		},
+		&cli.StringFlag{
+			Name:        "proxy",
+			Usage:       "The proxy every request is sent through, e.g http://host:8080 or socks5://host:1080. (default: HTTP_PROXY/HTTPS_PROXY)",
+			Destination: &options.Proxy,
+		},
+		&cli.StringFlag{
+			Name:        "user-agent",
+			Usage:       "The user agent sent with every request.",
+			Value:       scraper.DefaultUserAgent,
+			Destination: &options.UserAgent,
+		},
+		&cli.StringSliceFlag{
+			Name:  "header",
+			Usage: "A extra header sent with every request in the 'Name: value' form, can be given multiple times.",
+		},
+		&cli.StringFlag{
+			Name:        "ca-bundle",
+			Usage:       "A pem file of certificate authorities to trust in addition to the system certificate authorities.",
+			Destination: &options.CABundle,
+		},
+	}
+}
+
+// formatFlag is the format the images listed (by list or a dry run) are written
+// in, including the input formats of external downloaders.
+func formatFlag() cli.Flag {
+	return &cli.StringFlag{
+		Name:  "format",
+		Usage: "The format each listed image (list or --dry-run) is written in: text, json, urls, aria2 or wget.",
+		Value: scraper.ExportText,
+	}
+}
+
+// metricsAddrFlag is the address the prometheus metrics of a download or watch
+// are served on.
+func metricsAddrFlag() cli.Flag {
+	return &cli.StringFlag{
+		Name:  "metrics-addr",
+		Usage: "Serves prometheus metrics of the run on /metrics of the given address, e.g :9090.",
+	}
+}
+
+// jsonFlag writes the images listed (by list or a dry run) as json lines, for
+// piping into other tools. The same as --format json.
+func jsonFlag() cli.Flag {
+	return &cli.BoolFlag{
+		Name:  "json",
+		Usage: "Writes each listed image (list or --dry-run) as a json line of the subreddit, id, link, path and if it exists.",
+	}
+}
@@ -1,10 +1,21 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
+	"net"
+	"net/http"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 
+	"github.com/stephensli/mavic/internal/auth"
+	"github.com/stephensli/mavic/internal/gallery"
+	"github.com/stephensli/mavic/internal/logging"
 	"github.com/stephensli/mavic/internal/scraper"
 	"github.com/urfave/cli/v2"
 )
@@ -15,105 +26,450 @@ var options = scraper.Options{}
 func setupApplicationInformation() {
 	app.Name = "Mavic"
 	app.Description = "Mavic is a CLI application designed to download direct images found on selected reddit subreddits."
-	app.Usage = ".\\mavic.exe -l 100 --output ./pictures -f cute pics memes"
+	app.Usage = ".\\mavic.exe download -l 100 --output ./pictures -f cute pics memes"
 	app.Authors = []*cli.Author{{Name: "Stephen Lineker-Miller", Email: "slinekermiller@gmail.com"}}
 	app.Version = "0.2.1"
 }
 
 func setupApplicationFlags() {
-	app.Flags = []cli.Flag{
-		&cli.StringFlag{
-			Name:        "output",
-			Aliases:     []string{"o"},
-			Usage:       "The output directory to store the images.",
-			Value:       "./",
-			Destination: &options.OutputDirectory,
-		}, &cli.IntFlag{
-			Name:        "limit",
-			Aliases:     []string{"l"},
-			Usage:       "The total number of posts max per sub-reddit",
-			Value:       50,
-			Destination: &options.ImageLimit,
+	app.Flags = globalFlags()
+}
+
+func setupApplicationCommands() {
+	app.Commands = []*cli.Command{
+		{
+			Name:      "download",
+			Usage:     "Downloads the images of the sub reddits, the default when no command is given.",
+			ArgsUsage: "[subreddits...]",
+			Flags: append(scrapeFlags(),
+				&cli.BoolFlag{
+					Name:  "dry-run",
+					Usage: "Lists the images that would be downloaded and where they would be written, without downloading them.",
+				},
+				formatFlag(),
+				jsonFlag(),
+				metricsAddrFlag(),
+			),
+			Action: start,
+		},
+		{
+			Name:      "watch",
+			Usage:     "Keeps running, polling the sub reddits for new posts and downloading only the new posts.",
+			ArgsUsage: "[subreddits...]",
+			Flags: append(scrapeFlags(), &cli.DurationFlag{
+				Name:    "interval",
+				Aliases: []string{"i"},
+				Usage:   "How often each sub reddit is polled for new posts.",
+				Value:   scraper.DefaultWatchInterval,
+			}, metricsAddrFlag()),
+			Action: watch,
 		},
-		&cli.BoolFlag{
-			Name:        "frontpage",
-			Aliases:     []string{"f"},
-			Usage:       "If the front page should be scrapped or not.",
-			Destination: &options.FrontPage,
+		{
+			Name:      "list",
+			Usage:     "Lists the images of the sub reddits and where they would be written, without downloading them.",
+			ArgsUsage: "[subreddits...]",
+			Flags:     append(scrapeFlags(), formatFlag(), jsonFlag()),
+			Action:    list,
 		},
-		&cli.StringFlag{
-			Name:        "type",
-			Aliases:     []string{"t"},
-			Usage:       "What kind of page type should reddit be during the scrapping process. e.g hot, new. top.",
-			Value:       "hot",
-			Destination: &options.PageType,
+		{
+			Name:      "verify",
+			Usage:     "Verifies every image and video within a download directory, listing (or fixing) the broken files.",
+			ArgsUsage: "<directory>",
+			Flags: append(connectionFlags(),
+				&cli.StringSliceFlag{
+					Name:  "report",
+					Usage: "A report of a previous run, used to find missing images and to download broken images again. Can be given multiple times.",
+				},
+				&cli.BoolFlag{
+					Name:  "fix",
+					Usage: "Downloads the broken and missing images again when their link is known from the reports, otherwise removes them.",
+				},
+				&cli.BoolFlag{
+					Name:  "json",
+					Usage: "Writes each problem as a json line of the path, problem, reason, link and how it was fixed.",
+				},
+			),
+			Action: verify,
 		},
-		&cli.BoolFlag{
-			Name:        "root",
-			Aliases:     []string{"r"},
-			Usage:       "If specified, downloads the images directly into the root, not the subreddit folder.",
-			Destination: &options.RootFolderOnly,
+		{
+			Name:      "gallery",
+			Usage:     "Generates a static html gallery from a download directory.",
+			ArgsUsage: "<directory>",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:    "output",
+					Aliases: []string{"o"},
+					Usage:   "The directory the gallery is written into. (default: <directory>/gallery)",
+				},
+			},
+			Action: generateGallery,
 		},
-		&cli.BoolFlag{
-			Name:        "progressBar",
-			Aliases:     []string{"p"},
-			Usage:       "If the progress bar should be displayed or not.",
-			Value:       false,
-			Destination: &options.DisplayLoading,
+		{
+			Name:   "config",
+			Usage:  "Shows the options of the config file (and the selected profile) that are applied to every run.",
+			Action: showConfig,
 		},
 	}
 }
 
-// processSubreddits takes in a ring of possible sub reddits and splits them into
-// a slice of the sub reddits to be processed, there is currently a bug with the
-// cli tools which is resulting in the funky processing and its best to just
-// process it as a string for the time being.
-func processSubreddits(arguments []string) []string {
-	// since it only seems to parse the first element, even though more was selected
-	// so we push it here and then go and grab the remaining.
-	var processed []string
-
-	for i := 0; i < len(arguments); i++ {
-		value := arguments[i]
-
-		// if we have hit the next command, then we must breakout since we
-		// no longer have any more subs.
-		if strings.HasPrefix(value, "-") {
-			break
+// start is called by the cli control when the download command is used, setting
+// up and building a context around the cli application before downloading the
+// images of every sub reddit.
+func start(c *cli.Context) error {
+	redditScraper, err := newScraper(c)
+
+	if err != nil {
+		return err
+	}
+
+	if c.Bool("dry-run") {
+		var planned, existing int
+
+		err = listImages(c, redditScraper, func(image scraper.PlannedImage) {
+			planned += 1
+
+			if image.Exists {
+				existing += 1
+			}
+		})
+
+		// the summary is written to stderr, keeping stdout to just the images.
+		fmt.Fprintf(os.Stderr, "Dry run, %v images would be downloaded and %v already exist.\n",
+			planned-existing, existing)
+
+		return exitError(c, err)
+	}
+
+	stopMetrics, err := serveMetrics(c)
+
+	if err != nil {
+		return err
+	}
+
+	defer stopMetrics()
+	return exitError(c, redditScraper.Start(c.Context))
+}
+
+// watch is called by the cli control when the watch command is used, polling the
+// sub reddits for new posts until interrupted.
+func watch(c *cli.Context) error {
+	redditScraper, err := newScraper(c)
+
+	if err != nil {
+		return err
+	}
+
+	stopMetrics, err := serveMetrics(c)
+
+	if err != nil {
+		return err
+	}
+
+	defer stopMetrics()
+
+	err = redditScraper.Watch(c.Context, c.Duration("interval"))
+
+	// watching only stops once interrupted, which is the expected way to stop.
+	if errors.Is(err, context.Canceled) {
+		return nil
+	}
+
+	return exitError(c, err)
+}
+
+// list is called by the cli control when the list command is used, printing the
+// link of every image that would be downloaded and the path it would be written to.
+func list(c *cli.Context) error {
+	redditScraper, err := newScraper(c)
+
+	if err != nil {
+		return err
+	}
+
+	return exitError(c, listImages(c, redditScraper, nil))
+}
+
+// listImages writes the images that would be downloaded to stdout in the format
+// given with --format (or --json), calling onImage (if not nil) for each image.
+func listImages(c *cli.Context, redditScraper scraper.Scraper, onImage func(image scraper.PlannedImage)) error {
+	format := c.String("format")
+
+	if c.Bool("json") {
+		format = scraper.ExportJSON
+	}
+
+	// the external downloaders cannot write into a archive.
+	if options.ArchivePath != "" && (format == scraper.ExportAria2 || format == scraper.ExportWget) {
+		return fmt.Errorf("%w: '%v' cannot be used when writing into a archive", scraper.ErrInvalidExportFormat, format)
+	}
+
+	exporter, err := scraper.NewExporter(os.Stdout, format)
+
+	if err != nil {
+		return err
+	}
+
+	var writeErr error
+
+	err = redditScraper.List(c.Context, func(image scraper.PlannedImage) {
+		if writeErr == nil {
+			writeErr = exporter.Write(image)
+		}
+
+		if onImage != nil {
+			onImage(image)
 		}
+	})
 
-		processed = append(processed, value)
+	if err != nil {
+		return err
 	}
 
-	return processed
+	return writeErr
 }
 
-// start is called by the cli control when the cli controls are parsed, setting up
-// and building a context around the cli application. This is the time the sub
-// reddits are parsed since the cli tools don't support binding stringSlices.
-func start(c *cli.Context) error {
-	options.Subreddits = processSubreddits(c.Args().Slice())
+// verify is called by the cli control when the verify command is used, listing
+// the problems found within the download directory and fixing them with --fix.
+func verify(c *cli.Context) error {
+	if c.Args().Len() != 1 {
+		return cli.Exit(fmt.Sprintf("a single download directory must be provided, reference %v.exe verify --help for more information.",
+			strings.ToLower(c.App.Name)), exitCodeUsage)
+	}
 
-	// if it equals nil, and no sub reddits was given, then just set them
-	// as s empty slice, letting the scraper handle the empty case as
-	// it should.
-	if options.Subreddits == nil || len(options.Subreddits) == 0 {
-		log.Fatalf("no subreddits where provided, reference %v.exe --help for more information.\n", strings.ToLower(c.App.Name))
+	// only the connection options of the config file are applied, the reports of
+	// the config file are written by downloads and may not exist yet.
+	if err := applyConfigFlags(c, connectionFlags()); err != nil {
+		return err
 	}
 
-	// create a new reddit scraper and process through all the sub reddits
-	// downloading the images in the output folder / sub reddit / image.
-	scraper := scraper.NewScraper(options)
-	scraper.Start()
+	options.Headers = c.StringSlice("header")
+	client, err := scraper.NewHTTPClient(options)
+
+	if err != nil {
+		return exitError(c, err)
+	}
+
+	problems, err := scraper.Verify(c.Context, scraper.VerifyOptions{
+		Directory:  c.Args().First(),
+		Reports:    c.StringSlice("report"),
+		Fix:        c.Bool("fix"),
+		HTTPClient: client,
+	})
+
+	if err != nil {
+		return exitError(c, err)
+	}
+
+	unfixed := 0
+
+	for _, problem := range problems {
+		if problem.Fix == "" || problem.Fix == scraper.FixFailed {
+			unfixed += 1
+		}
+
+		if c.Bool("json") {
+			line, _ := json.Marshal(problem)
+			fmt.Println(string(line))
+			continue
+		}
+
+		switch problem.Fix {
+		case "":
+			fmt.Printf("%v: %v (%v)\n", problem.Path, problem.Problem, problem.Reason)
+		case scraper.FixFailed:
+			fmt.Printf("%v: %v (%v), failed to fix: %v\n", problem.Path, problem.Problem, problem.Reason, problem.FixError)
+		default:
+			fmt.Printf("%v: %v (%v), %v\n", problem.Path, problem.Problem, problem.Reason, strings.ToLower(problem.Fix))
+		}
+	}
+
+	summary := fmt.Sprintf("%v problems found, %v fixed.", len(problems), len(problems)-unfixed)
+
+	if unfixed > 0 {
+		return cli.Exit(summary, exitCodeFailure)
+	}
+
+	fmt.Fprintln(os.Stderr, summary)
 	return nil
 }
 
+// newScraper creates the reddit scraper from the options of the command line, the
+// config file and the credentials file. The sub reddits are the arguments of the
+// given context, which is either the application or the command being run.
+func newScraper(c *cli.Context) (scraper.Scraper, error) {
+	options.Subreddits = c.Args().Slice()
+
+	if err := applyConfig(c); err != nil {
+		return scraper.Scraper{}, err
+	}
+
+	options.Headers = c.StringSlice("header")
+
+	if path := c.String("credentials"); path != "" {
+		credentials, err := auth.LoadFile(path)
+
+		if err != nil {
+			return scraper.Scraper{}, cli.Exit(fmt.Sprintf("failed to load credentials: %v", err), exitCodeUsage)
+		}
+
+		options.Credentials = options.Credentials.Merge(credentials)
+	}
+
+	logger, err := newLogger(c)
+
+	if err != nil {
+		return scraper.Scraper{}, exitError(c, err)
+	}
+
+	options.Logger = logger
+
+	// the metrics are only recorded when they are served, the dry run and list
+	// don't serve them.
+	if c.String("metrics-addr") != "" && !c.Bool("dry-run") {
+		options.Metrics = scraper.NewMetrics()
+	}
+
+	// create a new reddit scraper which processes through all the sub reddits
+	// downloading the images in the output folder / sub reddit / image.
+	redditScraper, err := scraper.NewScraper(options)
+
+	if err != nil {
+		return scraper.Scraper{}, exitError(c, err)
+	}
+
+	return redditScraper, nil
+}
+
+// serveMetrics serves the prometheus metrics of the run on /metrics of the address
+// given with --metrics-addr, returning a function that stops serving them. The
+// address is listened on before the run starts, so a address that is already in
+// use fails straight away. Nothing is served when no address is given.
+func serveMetrics(c *cli.Context) (func(), error) {
+	metricsAddr := c.String("metrics-addr")
+
+	if options.Metrics == nil || metricsAddr == "" {
+		return func() {}, nil
+	}
+
+	listener, err := net.Listen("tcp", metricsAddr)
+
+	if err != nil {
+		return nil, cli.Exit(fmt.Sprintf("failed to serve metrics on %v: %v", metricsAddr, err), exitCodeUsage)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", options.Metrics.Handler())
+	server := &http.Server{Handler: mux}
+
+	go func() {
+		_ = server.Serve(listener)
+	}()
+
+	return func() { _ = server.Close() }, nil
+}
+
+// newLogger creates the logger the events of the run are written to on stderr.
+// Unless a level is given, only warnings and errors are logged alongside the
+// progress bar since the events would otherwise be drawn over by the bar.
+func newLogger(c *cli.Context) (*logging.Logger, error) {
+	level := logging.LevelInfo
+
+	if options.DisplayLoading {
+		level = logging.LevelWarn
+	}
+
+	if name := c.String("log-level"); name != "" {
+		var err error
+
+		if level, err = logging.ParseLevel(name); err != nil {
+			return nil, err
+		}
+	}
+
+	return logging.New(os.Stderr, c.String("log-format"), level)
+}
+
+// The exit codes used when the application fails, allowing scripts to tell
+// apart bad usage from a run where only some of the sub reddits failed.
+const (
+	exitCodeFailure      = 1
+	exitCodeUsage        = 2
+	exitCodeTargetFailed = 3
+	exitCodeInterrupted  = 130
+)
+
+// exitError converts a error returned by the scraper into a cli exit error with
+// the exit code matching the kind of failure, nil is returned as is.
+func exitError(c *cli.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var targetErrors scraper.TargetErrors
+
+	switch {
+	case errors.Is(err, context.Canceled):
+		return cli.Exit("interrupted, the downloads completed so far have been kept.", exitCodeInterrupted)
+	case errors.Is(err, scraper.ErrNoSubreddits):
+		return cli.Exit(fmt.Sprintf("no subreddits where provided, reference %v.exe --help for more information.",
+			strings.ToLower(c.App.Name)), exitCodeUsage)
+	case errors.Is(err, scraper.ErrInvalidPageType),
+		errors.Is(err, scraper.ErrInvalidReportPath),
+		errors.Is(err, scraper.ErrInvalidArchivePath),
+		errors.Is(err, scraper.ErrInvalidProxy),
+		errors.Is(err, scraper.ErrInvalidHeader),
+		errors.Is(err, scraper.ErrInvalidCABundle),
+		errors.Is(err, auth.ErrMissingCredentials),
+		errors.Is(err, scraper.ErrUserRequired),
+		errors.Is(err, scraper.ErrWatchArchive),
+		errors.Is(err, scraper.ErrInvalidExportFormat),
+		errors.Is(err, logging.ErrInvalidLevel),
+		errors.Is(err, logging.ErrInvalidFormat):
+		return cli.Exit(err.Error(), exitCodeUsage)
+	case errors.As(err, &targetErrors):
+		messages := make([]string, len(targetErrors))
+
+		for i, targetErr := range targetErrors {
+			messages[i] = fmt.Sprintf("failed to scrape %v", targetErr)
+		}
+
+		return cli.Exit(strings.Join(messages, "\n"), exitCodeTargetFailed)
+	}
+
+	return cli.Exit(err.Error(), exitCodeFailure)
+}
+
+// generateGallery is called by the cli control when the gallery command is used,
+// generating the static html gallery for the given download directory.
+func generateGallery(c *cli.Context) error {
+	if c.Args().Len() != 1 {
+		return cli.Exit(fmt.Sprintf("a single download directory must be provided, reference %v.exe gallery --help for more information.",
+			strings.ToLower(c.App.Name)), exitCodeUsage)
+	}
+
+	return exitError(c, gallery.Generate(gallery.Options{
+		Directory:       c.Args().First(),
+		OutputDirectory: c.String("output"),
+	}))
+}
+
 func main() {
 	setupApplicationInformation()
 	setupApplicationFlags()
+	setupApplicationCommands()
+
+	// the first interrupt cancels the run, allowing the in-flight downloads to
+	// be cleaned up and the summary printed. Once cancelled the signals are no
+	// longer caught, so a second interrupt forcefully stops the application.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
 
-	app.Action = start
-	err := app.Run(os.Args)
+	err := app.RunContext(ctx, normalizeArgs(app, os.Args))
 
 	if err != nil {
 		log.Fatal(err)
@@ -0,0 +1,317 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// format is the type of archive being written, determined by the extension.
+type format int
+
+const (
+	unknownFormat format = iota
+	zipFormat
+	tarFormat
+	tarGzipFormat
+)
+
+// detectFormat determines the archive format from the extension of the path.
+func detectFormat(path string) format {
+	lower := strings.ToLower(path)
+
+	switch {
+	case strings.HasSuffix(lower, ".zip"):
+		return zipFormat
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return tarGzipFormat
+	case strings.HasSuffix(lower, ".tar"):
+		return tarFormat
+	}
+
+	return unknownFormat
+}
+
+// Supported returns true if the path has the extension of a supported archive
+// format (zip, tar, tar.gz or tgz).
+func Supported(path string) bool {
+	return detectFormat(path) != unknownFormat
+}
+
+// Archive is a zip or tar archive that files are streamed into once they have
+// completed downloading. The archive is written to a temporary file next to the
+// destination and only replaces the destination on Close, so a interrupted run
+// never corrupts a existing archive.
+type Archive struct {
+	// mutex serialises all writes into the archive, archive writers are not safe
+	// to be used across concurrent downloads.
+	mutex sync.Mutex
+	// the destination path of the archive.
+	path string
+	// the temporary file the archive is written into.
+	file *os.File
+	// entries contains the names of every entry within the archive, including
+	// all the entries of the existing archive.
+	entries map[string]bool
+
+	zipWriter  *zip.Writer
+	tarWriter  *tar.Writer
+	gzipWriter *gzip.Writer
+}
+
+// Open creates a new archive at the given path. If a archive already exists at
+// the path, all the existing entries are carried over into the new archive and
+// can be checked with Contains to skip downloading them again.
+func Open(path string) (*Archive, error) {
+	archiveFormat := detectFormat(path)
+
+	if archiveFormat == unknownFormat {
+		return nil, fmt.Errorf("unsupported archive format '%v', expected .zip, .tar or .tar.gz", filepath.Base(path))
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return nil, err
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+
+	if err != nil {
+		return nil, err
+	}
+
+	// temporary files are created readable only by the owner, so the archive
+	// keeps the mode of the existing archive, or the usual mode of a new file.
+	mode := os.FileMode(0644)
+
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	if err := file.Chmod(mode); err != nil {
+		_ = file.Close()
+		_ = os.Remove(file.Name())
+		return nil, err
+	}
+
+	a := &Archive{path: path, file: file, entries: map[string]bool{}}
+
+	switch archiveFormat {
+	case zipFormat:
+		a.zipWriter = zip.NewWriter(file)
+		err = a.copyExistingZip()
+	case tarFormat:
+		a.tarWriter = tar.NewWriter(file)
+		err = a.copyExistingTar(false)
+	case tarGzipFormat:
+		a.gzipWriter = gzip.NewWriter(file)
+		a.tarWriter = tar.NewWriter(a.gzipWriter)
+		err = a.copyExistingTar(true)
+	}
+
+	if err != nil {
+		a.Abort()
+		return nil, err
+	}
+
+	return a, nil
+}
+
+// copyExistingZip copies all the entries of a existing zip archive into the new
+// archive without decompressing them.
+func (a *Archive) copyExistingZip() error {
+	reader, err := zip.OpenReader(a.path)
+
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	defer reader.Close()
+
+	for _, f := range reader.File {
+		if err := a.zipWriter.Copy(f); err != nil {
+			return err
+		}
+
+		a.entries[f.Name] = true
+	}
+
+	return nil
+}
+
+// copyExistingTar copies all the entries of a existing tar archive into the new
+// archive, decompressing the existing archive when gzipped.
+func (a *Archive) copyExistingTar(gzipped bool) error {
+	existing, err := os.Open(a.path)
+
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	defer existing.Close()
+	var reader io.Reader = existing
+
+	if gzipped {
+		gzipReader, err := gzip.NewReader(existing)
+
+		if err != nil {
+			return err
+		}
+
+		defer gzipReader.Close()
+		reader = gzipReader
+	}
+
+	tarReader := tar.NewReader(reader)
+
+	for {
+		header, err := tarReader.Next()
+
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if err := a.tarWriter.WriteHeader(header); err != nil {
+			return err
+		}
+
+		if _, err := io.Copy(a.tarWriter, tarReader); err != nil {
+			return err
+		}
+
+		a.entries[header.Name] = true
+	}
+}
+
+// Contains returns true if a entry with the given name already exists within
+// the archive, names always use forward slashes.
+func (a *Archive) Contains(name string) bool {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	return a.entries[name]
+}
+
+// Add streams the file at the given path into the archive under the given entry
+// name. Media is already compressed, so zip entries are stored over deflated.
+func (a *Archive) Add(name string, path string) error {
+	in, err := os.Open(path)
+
+	if err != nil {
+		return err
+	}
+
+	defer in.Close()
+	info, err := in.Stat()
+
+	if err != nil {
+		return err
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if a.zipWriter != nil {
+		header, err := zip.FileInfoHeader(info)
+
+		if err != nil {
+			return err
+		}
+
+		header.Name = name
+		header.Method = zip.Store
+
+		w, err := a.zipWriter.CreateHeader(header)
+
+		if err != nil {
+			return err
+		}
+
+		if _, err := io.Copy(w, in); err != nil {
+			return err
+		}
+	} else {
+		header, err := tar.FileInfoHeader(info, "")
+
+		if err != nil {
+			return err
+		}
+
+		header.Name = name
+
+		if err := a.tarWriter.WriteHeader(header); err != nil {
+			return err
+		}
+
+		if _, err := io.Copy(a.tarWriter, in); err != nil {
+			return err
+		}
+	}
+
+	a.entries[name] = true
+	return nil
+}
+
+// Close finishes writing the archive and moves it into place over any existing
+// archive at the destination path.
+func (a *Archive) Close() error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	var err error
+
+	if a.zipWriter != nil {
+		err = a.zipWriter.Close()
+	}
+
+	if a.tarWriter != nil {
+		err = a.tarWriter.Close()
+	}
+
+	if a.gzipWriter != nil && err == nil {
+		err = a.gzipWriter.Close()
+	}
+
+	if err == nil {
+		err = a.file.Sync()
+	}
+
+	if closeErr := a.file.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		_ = os.Remove(a.file.Name())
+		return err
+	}
+
+	return os.Rename(a.file.Name(), a.path)
+}
+
+// Abort discards the archive being written, leaving any existing archive at the
+// destination path untouched.
+func (a *Archive) Abort() {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	_ = a.file.Close()
+	_ = os.Remove(a.file.Name())
+}
@@ -0,0 +1,158 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readEntries reads every entry name and content from the archive at the path.
+func readEntries(t *testing.T, path string) map[string]string {
+	entries := map[string]string{}
+
+	switch detectFormat(path) {
+	case zipFormat:
+		reader, err := zip.OpenReader(path)
+		require.NoError(t, err)
+		defer reader.Close()
+
+		for _, f := range reader.File {
+			rc, err := f.Open()
+			require.NoError(t, err)
+			data, err := io.ReadAll(rc)
+			require.NoError(t, err)
+			_ = rc.Close()
+			entries[f.Name] = string(data)
+		}
+	default:
+		f, err := os.Open(path)
+		require.NoError(t, err)
+		defer f.Close()
+
+		var reader io.Reader = f
+
+		if detectFormat(path) == tarGzipFormat {
+			gzipReader, err := gzip.NewReader(f)
+			require.NoError(t, err)
+			reader = gzipReader
+		}
+
+		tarReader := tar.NewReader(reader)
+
+		for {
+			header, err := tarReader.Next()
+
+			if err == io.EOF {
+				break
+			}
+
+			require.NoError(t, err)
+			data, err := io.ReadAll(tarReader)
+			require.NoError(t, err)
+			entries[header.Name] = string(data)
+		}
+	}
+
+	return entries
+}
+
+// TestArchiveAppend ensures files are written into the archive using the given
+// entry names and that the entries of a existing archive are kept and reported
+// as already existing when the archive is opened again.
+func TestArchiveAppend(t *testing.T) {
+	for _, name := range []string{"out.zip", "out.tar", "out.tar.gz"} {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			archivePath := filepath.Join(dir, name)
+
+			source := filepath.Join(dir, "source.jpg")
+			require.NoError(t, os.WriteFile(source, []byte("first"), 0644))
+
+			a, err := Open(archivePath)
+			require.NoError(t, err)
+			assert.False(t, a.Contains("cute/a.jpg"))
+			require.NoError(t, a.Add("cute/a.jpg", source))
+			assert.True(t, a.Contains("cute/a.jpg"))
+			require.NoError(t, a.Close())
+
+			require.NoError(t, os.WriteFile(source, []byte("second"), 0644))
+
+			a, err = Open(archivePath)
+			require.NoError(t, err)
+			assert.True(t, a.Contains("cute/a.jpg"))
+			require.NoError(t, a.Add("pics/b.jpg", source))
+			require.NoError(t, a.Close())
+
+			assert.Equal(t, map[string]string{"cute/a.jpg": "first", "pics/b.jpg": "second"}, readEntries(t, archivePath))
+
+			// no temporary files should be left next to the archive.
+			files, err := os.ReadDir(dir)
+			require.NoError(t, err)
+			assert.Len(t, files, 2)
+		})
+	}
+}
+
+// TestArchiveAbort ensures a aborted archive never replaces the existing archive.
+func TestArchiveAbort(t *testing.T) {
+	dir := t.TempDir()
+	archivePath := filepath.Join(dir, "out.zip")
+	source := filepath.Join(dir, "source.jpg")
+	require.NoError(t, os.WriteFile(source, []byte("first"), 0644))
+
+	a, err := Open(archivePath)
+	require.NoError(t, err)
+	require.NoError(t, a.Add("a.jpg", source))
+	require.NoError(t, a.Close())
+
+	a, err = Open(archivePath)
+	require.NoError(t, err)
+	require.NoError(t, a.Add("b.jpg", source))
+	a.Abort()
+
+	assert.Equal(t, map[string]string{"a.jpg": "first"}, readEntries(t, archivePath))
+}
+
+// TestArchiveMode ensures a new archive is readable by everyone and a existing
+// archive keeps its mode, even though it is written to a temporary file first.
+func TestArchiveMode(t *testing.T) {
+	dir := t.TempDir()
+	archivePath := filepath.Join(dir, "out.tar.gz")
+	source := filepath.Join(dir, "source.jpg")
+	require.NoError(t, os.WriteFile(source, []byte("first"), 0644))
+
+	mode := func() os.FileMode {
+		info, err := os.Stat(archivePath)
+		require.NoError(t, err)
+		return info.Mode().Perm()
+	}
+
+	a, err := Open(archivePath)
+	require.NoError(t, err)
+	require.NoError(t, a.Add("a.jpg", source))
+	require.NoError(t, a.Close())
+	assert.Equal(t, os.FileMode(0644), mode())
+
+	require.NoError(t, os.Chmod(archivePath, 0640))
+
+	a, err = Open(archivePath)
+	require.NoError(t, err)
+	require.NoError(t, a.Add("b.jpg", source))
+	require.NoError(t, a.Close())
+	assert.Equal(t, os.FileMode(0640), mode())
+}
+
+// TestOpenUnsupported ensures unknown archive extensions are rejected.
+func TestOpenUnsupported(t *testing.T) {
+	_, err := Open(filepath.Join(t.TempDir(), "out.rar"))
+	assert.Error(t, err)
+	assert.False(t, Supported("out.rar"))
+	assert.True(t, Supported("OUT.TGZ"))
+}
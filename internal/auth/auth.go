@@ -0,0 +1,230 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultTokenURL is the reddit endpoint access tokens are requested from.
+const DefaultTokenURL = "https://www.reddit.com/api/v1/access_token"
+
+// expiryMargin is how long before the reported expiry a token is refreshed,
+// ensuring a token never expires part way through a request.
+const expiryMargin = time.Minute
+
+var (
+	// ErrMissingCredentials is returned when a username is given without a password
+	// or credentials are given without the client id.
+	ErrMissingCredentials = errors.New("missing credentials")
+	// ErrInvalidCredentials is returned when reddit rejected the credentials.
+	ErrInvalidCredentials = errors.New("invalid credentials")
+)
+
+// Credentials are the credentials of the reddit application (and optionally the
+// user) used to authenticate with reddit. When a username and password are given
+// the script application password grant is used, otherwise the application only
+// client credentials grant is used.
+type Credentials struct {
+	// The client id of the reddit application.
+	ClientID string `json:"clientId"`
+	// The client secret of the reddit application.
+	ClientSecret string `json:"clientSecret"`
+	// The reddit username, only for script applications.
+	Username string `json:"username,omitempty"`
+	// The reddit password, only for script applications.
+	Password string `json:"password,omitempty"`
+}
+
+// Empty returns true if no credentials have been given at all, in which case
+// reddit is accessed anonymously.
+func (c Credentials) Empty() bool {
+	return c == Credentials{}
+}
+
+// Validate ensures the credentials are complete enough to request a token.
+func (c Credentials) Validate() error {
+	if c.ClientID == "" {
+		return fmt.Errorf("%w: the client id is required", ErrMissingCredentials)
+	}
+
+	if (c.Username == "") != (c.Password == "") {
+		return fmt.Errorf("%w: both the username and password are required", ErrMissingCredentials)
+	}
+
+	return nil
+}
+
+// Merge returns the credentials with any empty values filled in from the other
+// credentials, allowing credentials to be layered from multiple sources.
+func (c Credentials) Merge(other Credentials) Credentials {
+	if c.ClientID == "" {
+		c.ClientID = other.ClientID
+	}
+
+	if c.ClientSecret == "" {
+		c.ClientSecret = other.ClientSecret
+	}
+
+	if c.Username == "" {
+		c.Username = other.Username
+	}
+
+	if c.Password == "" {
+		c.Password = other.Password
+	}
+
+	return c
+}
+
+// LoadFile loads the credentials from the json file at the given path.
+func LoadFile(path string) (Credentials, error) {
+	data, err := os.ReadFile(path)
+
+	if err != nil {
+		return Credentials{}, err
+	}
+
+	var credentials Credentials
+
+	if err := json.Unmarshal(data, &credentials); err != nil {
+		return Credentials{}, fmt.Errorf("failed to parse credentials %v: %w", path, err)
+	}
+
+	return credentials, nil
+}
+
+// tokenResponse is the response of the access token endpoint, reddit responds
+// with a successful status and the error set when the credentials are wrong.
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+	Error       string `json:"error"`
+}
+
+// TokenSource requests access tokens from reddit, caching the token until it is
+// about to expire. A single token source is safe to be shared across requests.
+type TokenSource struct {
+	mutex       sync.Mutex
+	client      *http.Client
+	credentials Credentials
+	tokenURL    string
+	// the current access token and when it expires, empty until requested.
+	token  string
+	expiry time.Time
+
+	// the clock used for the expiry, replaced in tests.
+	now func() time.Time
+}
+
+// NewTokenSource creates a token source requesting tokens from the given token
+// url (DefaultTokenURL when empty) with the given client.
+func NewTokenSource(client *http.Client, credentials Credentials, tokenURL string) *TokenSource {
+	if tokenURL == "" {
+		tokenURL = DefaultTokenURL
+	}
+
+	return &TokenSource{client: client, credentials: credentials, tokenURL: tokenURL, now: time.Now}
+}
+
+// Token returns a valid access token, requesting a new token if there is none
+// or the current token is about to expire.
+func (t *TokenSource) Token(ctx context.Context) (string, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.token != "" && t.now().Before(t.expiry) {
+		return t.token, nil
+	}
+
+	token, expiresIn, err := t.requestToken(ctx)
+
+	if err != nil {
+		return "", err
+	}
+
+	// a token that expires within the margin would already be expired, so it
+	// is refreshed half way through its lifetime instead.
+	margin := expiryMargin
+
+	if expiresIn <= expiryMargin {
+		margin = expiresIn / 2
+	}
+
+	t.token = token
+	t.expiry = t.now().Add(expiresIn - margin)
+	return t.token, nil
+}
+
+// Invalidate discards the current token, e.g when reddit rejected it, so the
+// next call to Token requests a new token.
+func (t *TokenSource) Invalidate() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.token = ""
+}
+
+func (t *TokenSource) requestToken(ctx context.Context) (string, time.Duration, error) {
+	form := url.Values{"grant_type": {"client_credentials"}}
+
+	if t.credentials.Username != "" {
+		form = url.Values{
+			"grant_type": {"password"},
+			"username":   {t.credentials.Username},
+			"password":   {t.credentials.Password},
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", t.tokenURL, strings.NewReader(form.Encode()))
+
+	if err != nil {
+		return "", 0, err
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(t.credentials.ClientID, t.credentials.ClientSecret)
+
+	resp, err := t.client.Do(req)
+
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to request access token: %w", err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		return "", 0, fmt.Errorf("%w: the client id or secret was rejected", ErrInvalidCredentials)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return "", 0, fmt.Errorf("failed to request access token: unexpected status %v", resp.Status)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to request access token: %w", err)
+	}
+
+	var token tokenResponse
+
+	if err := json.Unmarshal(body, &token); err != nil {
+		return "", 0, fmt.Errorf("failed to parse access token: %w", err)
+	}
+
+	if token.Error != "" || token.AccessToken == "" {
+		return "", 0, fmt.Errorf("%w: %v", ErrInvalidCredentials, token.Error)
+	}
+
+	return token.AccessToken, time.Duration(token.ExpiresIn) * time.Second, nil
+}
@@ -0,0 +1,162 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTokenServer creates a fake token endpoint issuing a numbered token for each
+// request made, recording the form of the last request.
+func newTokenServer(t *testing.T, expiresIn int) (*httptest.Server, *int, *http.Request) {
+	var requests int
+	var last http.Request
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		requests += 1
+		last = *r
+
+		id, secret, _ := r.BasicAuth()
+
+		if id != "client" || secret != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		// reddit responds with a successful status when the user credentials are wrong.
+		if r.PostForm.Get("grant_type") == "password" && r.PostForm.Get("password") != "hunter2" {
+			_, _ = w.Write([]byte(`{"error": "invalid_grant"}`))
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": fmt.Sprintf("token-%v", requests),
+			"token_type":   "bearer",
+			"expires_in":   expiresIn,
+		})
+	}))
+
+	t.Cleanup(server.Close)
+	return server, &requests, &last
+}
+
+// TestTokenSourcePasswordGrant ensures the password grant is used when a username
+// is given and the token is cached until it is about to expire.
+func TestTokenSourcePasswordGrant(t *testing.T) {
+	server, requests, last := newTokenServer(t, 3600)
+
+	clock := time.Date(2021, 10, 1, 0, 0, 0, 0, time.UTC)
+	source := NewTokenSource(http.DefaultClient, Credentials{ClientID: "client", ClientSecret: "secret",
+		Username: "user", Password: "hunter2"}, server.URL)
+	source.now = func() time.Time { return clock }
+
+	token, err := source.Token(context.Background())
+	require.NoError(t, err)
+
+	assert.Equal(t, "token-1", token)
+	assert.Equal(t, "password", last.PostForm.Get("grant_type"))
+	assert.Equal(t, "user", last.PostForm.Get("username"))
+
+	token, err = source.Token(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "token-1", token)
+	assert.Equal(t, 1, *requests)
+
+	// the token is refreshed ahead of the reported expiry.
+	clock = clock.Add(time.Hour - expiryMargin)
+
+	token, err = source.Token(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "token-2", token)
+	assert.Equal(t, 2, *requests)
+}
+
+// TestTokenSourceShortExpiry ensures a token that expires within the expiry margin
+// is still cached, being refreshed half way through its lifetime.
+func TestTokenSourceShortExpiry(t *testing.T) {
+	server, requests, _ := newTokenServer(t, 30)
+
+	clock := time.Date(2021, 10, 1, 0, 0, 0, 0, time.UTC)
+	source := NewTokenSource(http.DefaultClient, Credentials{ClientID: "client", ClientSecret: "secret"}, server.URL)
+	source.now = func() time.Time { return clock }
+
+	for i := 0; i < 3; i++ {
+		token, err := source.Token(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, "token-1", token)
+	}
+
+	assert.Equal(t, 1, *requests)
+
+	clock = clock.Add(15 * time.Second)
+
+	token, err := source.Token(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "token-2", token)
+	assert.Equal(t, 2, *requests)
+}
+
+// TestTokenSourceClientCredentials ensures the application only grant is used when
+// no username is given, and a invalidated token is requested again.
+func TestTokenSourceClientCredentials(t *testing.T) {
+	server, requests, last := newTokenServer(t, 3600)
+	source := NewTokenSource(http.DefaultClient, Credentials{ClientID: "client", ClientSecret: "secret"}, server.URL)
+
+	_, err := source.Token(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "client_credentials", last.PostForm.Get("grant_type"))
+	assert.Empty(t, last.PostForm.Get("username"))
+
+	source.Invalidate()
+
+	token, err := source.Token(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "token-2", token)
+	assert.Equal(t, 2, *requests)
+}
+
+// TestTokenSourceInvalidCredentials ensures rejected client and user credentials
+// are both returned as invalid credentials.
+func TestTokenSourceInvalidCredentials(t *testing.T) {
+	server, _, _ := newTokenServer(t, 3600)
+
+	source := NewTokenSource(http.DefaultClient, Credentials{ClientID: "client", ClientSecret: "wrong"}, server.URL)
+	_, err := source.Token(context.Background())
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+
+	source = NewTokenSource(http.DefaultClient, Credentials{ClientID: "client", ClientSecret: "secret",
+		Username: "user", Password: "wrong"}, server.URL)
+	_, err = source.Token(context.Background())
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+	assert.Contains(t, err.Error(), "invalid_grant")
+}
+
+// TestCredentials ensures credentials are validated, merged and loaded from file.
+func TestCredentials(t *testing.T) {
+	assert.True(t, Credentials{}.Empty())
+	assert.NoError(t, Credentials{ClientID: "client"}.Validate())
+	assert.ErrorIs(t, Credentials{ClientSecret: "secret"}.Validate(), ErrMissingCredentials)
+	assert.ErrorIs(t, Credentials{ClientID: "client", Username: "user"}.Validate(), ErrMissingCredentials)
+
+	path := filepath.Join(t.TempDir(), "credentials.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"clientId": "file", "clientSecret": "secret", "username": "user"}`), 0644))
+
+	loaded, err := LoadFile(path)
+	require.NoError(t, err)
+
+	merged := Credentials{ClientID: "flag", Password: "hunter2"}.Merge(loaded)
+	assert.Equal(t, Credentials{ClientID: "flag", ClientSecret: "secret", Username: "user", Password: "hunter2"}, merged)
+
+	_, err = LoadFile(filepath.Join(t.TempDir(), "missing.json"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,214 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	// ErrProfileNotFound is returned when the selected profile is not within the file.
+	ErrProfileNotFound = errors.New("profile not found")
+	// ErrUnsupportedFormat is returned when the config file is not a yaml file.
+	ErrUnsupportedFormat = errors.New("unsupported config format, the config must end in .yaml or .yml")
+)
+
+// Values are the option values of the config file keyed by the name of the
+// matching command line flag, e.g "output", "limit" or "retry-delay".
+type Values map[string]interface{}
+
+// File is a parsed config file, containing the option values applied to every run
+// and the named profiles which override them.
+type File struct {
+	// The option values applied to every run.
+	Values `yaml:",inline"`
+	// The named profiles, each overriding the option values when selected.
+	Profiles map[string]Values `yaml:"profiles"`
+}
+
+// DefaultPath returns the path of the config file within the XDG config directory,
+// $XDG_CONFIG_HOME/mavic/config.yaml, falling back to ~/.config when not set.
+func DefaultPath() string {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+
+	if dir == "" {
+		home, err := os.UserHomeDir()
+
+		if err != nil {
+			return ""
+		}
+
+		dir = filepath.Join(home, ".config")
+	}
+
+	return filepath.Join(dir, "mavic", "config.yaml")
+}
+
+// Discover returns the path of the config file within the XDG config directory
+// if it exists (config.yaml or config.yml), otherwise empty.
+func Discover() string {
+	path := DefaultPath()
+
+	if path == "" {
+		return ""
+	}
+
+	for _, candidate := range []string{path, strings.TrimSuffix(path, ".yaml") + ".yml"} {
+		if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
+			return candidate
+		}
+	}
+
+	return ""
+}
+
+// Load loads and parses the config file at the given path.
+func Load(path string) (File, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+	default:
+		return File{}, fmt.Errorf("%w: '%v'", ErrUnsupportedFormat, path)
+	}
+
+	data, err := os.ReadFile(path)
+
+	if err != nil {
+		return File{}, err
+	}
+
+	var file File
+
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return File{}, fmt.Errorf("failed to parse config %v: %w", path, err)
+	}
+
+	return file, nil
+}
+
+// Profile returns the option values of the given profile layered over the values
+// applied to every run, an empty name returns just the values applied to every run.
+func (f File) Profile(name string) (Values, error) {
+	values := Values{}
+
+	for key, value := range f.Values {
+		values[key] = value
+	}
+
+	if name == "" {
+		return values, nil
+	}
+
+	profile, ok := f.Profiles[name]
+
+	if !ok {
+		return nil, fmt.Errorf("%w: '%v'", ErrProfileNotFound, name)
+	}
+
+	for key, value := range profile {
+		values[key] = value
+	}
+
+	return values, nil
+}
+
+// Keys returns the keys of the values in sorted order, ensuring the values are
+// always applied in the same order.
+func (v Values) Keys() []string {
+	keys := make([]string, 0, len(v))
+
+	for key := range v {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+	return keys
+}
+
+// Strings returns the value of the given key as strings, a list returns each of
+// its items while a single value returns a list of just that value.
+func (v Values) Strings(key string) []string {
+	switch value := v[key].(type) {
+	case nil:
+		return nil
+	case []interface{}:
+		values := make([]string, len(value))
+
+		for i, item := range value {
+			values[i] = fmt.Sprint(item)
+		}
+
+		return values
+	default:
+		return []string{fmt.Sprint(value)}
+	}
+}
+
+// targetKeys are the keys of a target given as a mapping, in the order of the
+// "name:type:limit:folder" form. The interval follows the name as "name@interval".
+var targetKeys = []string{"name", "type", "limit", "folder"}
+
+// Targets returns the targets of the given key in the "name:type:limit:folder"
+// form. Each target can either be given in that form directly or as a mapping
+// of the name, type, limit and folder.
+func (v Values) Targets(key string) ([]string, error) {
+	items, ok := v[key].([]interface{})
+
+	if !ok {
+		return v.Strings(key), nil
+	}
+
+	targets := make([]string, len(items))
+
+	for i, item := range items {
+		var mapping map[string]interface{}
+
+		// mappings within a profile are decoded as the type of the profile.
+		switch value := item.(type) {
+		case map[string]interface{}:
+			mapping = value
+		case Values:
+			mapping = value
+		default:
+			targets[i] = fmt.Sprint(item)
+			continue
+		}
+
+		parts := make([]string, len(targetKeys))
+
+		for k, targetKey := range targetKeys {
+			if value, ok := mapping[targetKey]; ok {
+				parts[k] = fmt.Sprint(value)
+			}
+		}
+
+		if interval, ok := mapping["interval"]; ok {
+			parts[0] += "@" + fmt.Sprint(interval)
+		}
+
+		for mappingKey := range mapping {
+			if !containsString(targetKeys, mappingKey) && mappingKey != "interval" {
+				return nil, fmt.Errorf("unknown option '%v' for %v, expected name, type, limit, folder or interval",
+					mappingKey, key)
+			}
+		}
+
+		targets[i] = strings.TrimRight(strings.Join(parts, ":"), ":")
+	}
+
+	return targets, nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
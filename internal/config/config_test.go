@@ -0,0 +1,143 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const sampleConfig = `
+limit: 25
+type: top-week
+header:
+  - "X-A: 1"
+  - "X-B: 2"
+profiles:
+  wallpapers:
+    output: ./wallpapers
+    type: top-month
+    subreddits: [wallpapers, earthporn]
+  memes:
+    root: true
+    subreddits: memes
+`
+
+func writeConfig(t *testing.T, name string, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	return path
+}
+
+// TestLoadProfile ensures the selected profile is layered over the values applied
+// to every run.
+func TestLoadProfile(t *testing.T) {
+	file, err := Load(writeConfig(t, "config.yaml", sampleConfig))
+	require.NoError(t, err)
+
+	base, err := file.Profile("")
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"header", "limit", "type"}, base.Keys())
+	assert.Equal(t, []string{"25"}, base.Strings("limit"))
+	assert.Equal(t, []string{"X-A: 1", "X-B: 2"}, base.Strings("header"))
+
+	wallpapers, err := file.Profile("wallpapers")
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"top-month"}, wallpapers.Strings("type"))
+	assert.Equal(t, []string{"25"}, wallpapers.Strings("limit"))
+	assert.Equal(t, []string{"./wallpapers"}, wallpapers.Strings("output"))
+	assert.Equal(t, []string{"wallpapers", "earthporn"}, wallpapers.Strings("subreddits"))
+
+	memes, err := file.Profile("memes")
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"true"}, memes.Strings("root"))
+	assert.Equal(t, []string{"memes"}, memes.Strings("subreddits"))
+	assert.Nil(t, memes.Strings("output"))
+
+	// selecting a profile never modifies the values applied to every run.
+	assert.Equal(t, []string{"top-week"}, base.Strings("type"))
+
+	_, err = file.Profile("missing")
+	assert.ErrorIs(t, err, ErrProfileNotFound)
+}
+
+// TestLoadInvalid ensures unsupported and invalid config files are rejected.
+func TestLoadInvalid(t *testing.T) {
+	_, err := Load(writeConfig(t, "config.toml", "limit = 25"))
+	assert.ErrorIs(t, err, ErrUnsupportedFormat)
+
+	_, err = Load(writeConfig(t, "config.yml", "limit: [25"))
+	assert.Error(t, err)
+
+	_, err = Load(filepath.Join(t.TempDir(), "missing.yaml"))
+	assert.Error(t, err)
+}
+
+// TestDiscover ensures the config file is discovered within the XDG config
+// directory, falling back to ~/.config.
+func TestDiscover(t *testing.T) {
+	dir := t.TempDir()
+
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	assert.Equal(t, filepath.Join(dir, "mavic", "config.yaml"), DefaultPath())
+	assert.Empty(t, Discover())
+
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "mavic"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "mavic", "config.yml"), []byte(sampleConfig), 0644))
+	assert.Equal(t, filepath.Join(dir, "mavic", "config.yml"), Discover())
+
+	home := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", "")
+	t.Setenv("HOME", home)
+	assert.Equal(t, filepath.Join(home, ".config", "mavic", "config.yaml"), DefaultPath())
+}
+
+// TestTargets ensures targets can be given both in the "name:type:limit:folder"
+// form and as a mapping.
+func TestTargets(t *testing.T) {
+	file, err := Load(writeConfig(t, "config.yaml", `
+subreddits:
+  - wallpapers:top-week:200
+  - name: aww
+    type: hot
+    limit: 25
+    folder: animals
+  - name: pics
+    limit: 10
+  - name: cute
+    interval: 15m
+profiles:
+  single:
+    subreddits: cute
+  invalid:
+    subreddits:
+      - name: aww
+        output: ./aww
+`))
+	require.NoError(t, err)
+
+	values, err := file.Profile("")
+	require.NoError(t, err)
+
+	targets, err := values.Targets("subreddits")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"wallpapers:top-week:200", "aww:hot:25:animals", "pics::10", "cute@15m"}, targets)
+
+	values, err = file.Profile("single")
+	require.NoError(t, err)
+
+	targets, err = values.Targets("subreddits")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"cute"}, targets)
+
+	values, err = file.Profile("invalid")
+	require.NoError(t, err)
+
+	_, err = values.Targets("subreddits")
+	assert.Error(t, err)
+}
@@ -0,0 +1,352 @@
+package gallery
+
+import (
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/stephensli/mavic/internal/metadata"
+	"github.com/stephensli/mavic/internal/thumbnail"
+	"github.com/stephensli/mavic/web"
+)
+
+// The file extensions that are considered to be media and included within the
+// gallery, all other files (e.g reports) are ignored.
+var (
+	imageExtensions = map[string]bool{".jpg": true, ".jpeg": true, ".png": true, ".gif": true, ".webp": true}
+	videoExtensions = map[string]bool{".mp4": true, ".webm": true}
+)
+
+// Options are the options used to generate the static gallery.
+type Options struct {
+	// The download directory containing the images that the gallery is generated from.
+	Directory string
+	// The directory the gallery is written into, defaulting to a gallery folder
+	// within the download directory.
+	OutputDirectory string
+}
+
+// Item is a single image or video within the gallery.
+type Item struct {
+	// The title of the post, falling back to the file name when no metadata exists.
+	Title string
+	// The reddit user that made the post, empty when unknown.
+	Author string
+	// The link to the reddit post, empty when unknown.
+	Permalink string
+	// The path to the media file, relative to the gallery pages.
+	Path string
+	// The path to the preview shown in the grid, relative to the gallery pages.
+	Preview string
+	// If the item is a video and should be previewed as one.
+	Video bool
+}
+
+// Group is all the items of a single sub reddit, rendered as its own page.
+type Group struct {
+	// The name of the sub reddit (or folder) the items are from.
+	Name string
+	// The file name of the page for the group, relative to the gallery pages.
+	Page string
+	// The items within the group, sorted by path.
+	Items []Item
+}
+
+// Cover is the item used to represent the group on the index page.
+func (g Group) Cover() *Item {
+	for i := range g.Items {
+		if !g.Items[i].Video {
+			return &g.Items[i]
+		}
+	}
+
+	if len(g.Items) > 0 {
+		return &g.Items[0]
+	}
+
+	return nil
+}
+
+// page is the data passed into the templates for rendering a single page.
+type page struct {
+	Title  string
+	Groups []Group
+	Group  Group
+}
+
+// Generate walks the download directory and writes a self-contained static html
+// gallery into the output directory, with a index page and a page per sub reddit.
+// Metadata embedded into the files is used for titles and links back to reddit.
+func Generate(options Options) error {
+	if options.OutputDirectory == "" {
+		options.OutputDirectory = filepath.Join(options.Directory, "gallery")
+	}
+
+	groups, err := collectGroups(options)
+
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(options.OutputDirectory, os.ModePerm); err != nil {
+		return err
+	}
+
+	if err := copyStatic(options.OutputDirectory); err != nil {
+		return err
+	}
+
+	templates, err := template.ParseFS(web.Files, "template/layout.html.tmpl", "template/preview.html.tmpl")
+
+	if err != nil {
+		return err
+	}
+
+	indexTemplate := template.Must(templates.Clone())
+	template.Must(indexTemplate.ParseFS(web.Files, "template/index.html.tmpl"))
+
+	if err := render(indexTemplate, filepath.Join(options.OutputDirectory, "index.html"),
+		page{Title: "Mavic Gallery", Groups: groups}); err != nil {
+		return err
+	}
+
+	groupTemplate := template.Must(templates.Clone())
+	template.Must(groupTemplate.ParseFS(web.Files, "template/subreddit.html.tmpl"))
+
+	for _, group := range groups {
+		if err := render(groupTemplate, filepath.Join(options.OutputDirectory, group.Page),
+			page{Title: group.Name, Group: group}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// collectGroups walks the download directory grouping all the media by the sub
+// reddit it was downloaded from, using the embedded metadata if it exists and
+// otherwise the folder the file is within.
+func collectGroups(options Options) ([]Group, error) {
+	outputDir, err := filepath.Abs(options.OutputDirectory)
+
+	if err != nil {
+		return nil, err
+	}
+
+	byName := map[string]*Group{}
+
+	err = filepath.WalkDir(options.Directory, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			abs, _ := filepath.Abs(path)
+
+			// skip the gallery itself and any hidden folders (e.g thumbnails).
+			if abs == outputDir || (path != options.Directory && strings.HasPrefix(d.Name(), ".")) {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		ext := strings.ToLower(filepath.Ext(path))
+
+		if !imageExtensions[ext] && !videoExtensions[ext] {
+			return nil
+		}
+
+		item, name, err := newItem(options, outputDir, path)
+
+		if err != nil {
+			return err
+		}
+
+		group, ok := byName[name]
+
+		if !ok {
+			group = &Group{Name: name}
+			byName[name] = group
+		}
+
+		group.Items = append(group.Items, item)
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	groups := make([]Group, 0, len(byName))
+
+	for _, group := range byName {
+		sort.Slice(group.Items, func(i, j int) bool { return group.Items[i].Path < group.Items[j].Path })
+		groups = append(groups, *group)
+	}
+
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Name < groups[j].Name })
+
+	// different names can flatten into the same page (e.g walls/2024 and
+	// walls-2024), so later pages are given a numeric suffix. Pages are compared
+	// ignoring case since most file systems of windows and macos are.
+	pages := map[string]bool{}
+
+	for i := range groups {
+		page := pageName(groups[i].Name)
+		base := strings.TrimSuffix(page, ".html")
+
+		for n := 2; pages[strings.ToLower(page)]; n++ {
+			page = fmt.Sprintf("%v-%v.html", base, n)
+		}
+
+		pages[strings.ToLower(page)] = true
+		groups[i].Page = page
+	}
+
+	return groups, nil
+}
+
+// newItem creates the gallery item for the media file at the given path,
+// returning the name of the group the item belongs too.
+func newItem(options Options, outputDir string, path string) (Item, string, error) {
+	abs, err := filepath.Abs(path)
+
+	if err != nil {
+		return Item{}, "", err
+	}
+
+	rel, err := filepath.Rel(outputDir, abs)
+
+	if err != nil {
+		return Item{}, "", err
+	}
+
+	item := Item{
+		Title: filepath.Base(path),
+		Path:  escapePath(rel),
+		Video: videoExtensions[strings.ToLower(filepath.Ext(path))],
+	}
+
+	item.Preview = previewPath(options, outputDir, path, item.Path)
+
+	// the group defaults to the folder the file is within, with files directly
+	// in the download directory (root downloads) grouped together.
+	name := "other"
+
+	if dir, _ := filepath.Rel(options.Directory, filepath.Dir(path)); dir != "." {
+		name = filepath.ToSlash(dir)
+	}
+
+	// metadata is optional, files downloaded without embedding or formats that
+	// don't support it fall back to the file and folder names.
+	if m, err := metadata.Read(path); err == nil {
+		if m.Title != "" {
+			item.Title = m.Title
+		}
+
+		if m.Subreddit != "" {
+			name = m.Subreddit
+		}
+
+		item.Author = m.Author
+		item.Permalink = m.Permalink
+	}
+
+	return item, name, nil
+}
+
+// previewPath returns the relative url of the thumbnail generated during download
+// for the given file, falling back to the full file when no thumbnail exists.
+func previewPath(options Options, outputDir string, path string, fallback string) string {
+	thumbPath, err := thumbnail.Path(options.Directory, path)
+
+	if err != nil {
+		return fallback
+	}
+
+	if _, err := os.Stat(thumbPath); err != nil {
+		return fallback
+	}
+
+	thumbAbs, err := filepath.Abs(thumbPath)
+
+	if err != nil {
+		return fallback
+	}
+
+	rel, err := filepath.Rel(outputDir, thumbAbs)
+
+	if err != nil {
+		return fallback
+	}
+
+	return escapePath(rel)
+}
+
+// escapePath converts a relative file path into a escaped relative url.
+func escapePath(path string) string {
+	segments := strings.Split(filepath.ToSlash(path), "/")
+
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+
+	return strings.Join(segments, "/")
+}
+
+// pageName generates the page file name for a group, any character that is not
+// valid in a sub reddit name is replaced, flattening nested folders so that every
+// page lives next to the static assets.
+func pageName(name string) string {
+	return "r-" + strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '_' {
+			return r
+		}
+
+		return '-'
+	}, name) + ".html"
+}
+
+// copyStatic writes the embedded static assets into the gallery directory.
+func copyStatic(outputDir string) error {
+	return fs.WalkDir(web.Files, "static", func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		data, err := web.Files.ReadFile(path)
+
+		if err != nil {
+			return err
+		}
+
+		dest := filepath.Join(outputDir, filepath.FromSlash(path))
+
+		if err := os.MkdirAll(filepath.Dir(dest), os.ModePerm); err != nil {
+			return err
+		}
+
+		return os.WriteFile(dest, data, 0644)
+	})
+}
+
+func render(t *template.Template, path string, data page) error {
+	out, err := os.Create(path)
+
+	if err != nil {
+		return err
+	}
+
+	if err := t.ExecuteTemplate(out, "layout", data); err != nil {
+		_ = out.Close()
+		return fmt.Errorf("failed to render %v: %w", path, err)
+	}
+
+	return out.Close()
+}
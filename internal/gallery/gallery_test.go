@@ -0,0 +1,103 @@
+package gallery
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stephensli/mavic/internal/metadata"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeSamplePNG(t *testing.T, path string) {
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 4, 4))))
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), os.ModePerm))
+	require.NoError(t, os.WriteFile(path, buf.Bytes(), 0644))
+}
+
+// TestGenerate ensures a index page and a page per sub reddit are generated, with
+// embedded metadata used for titles and links and folders used otherwise.
+func TestGenerate(t *testing.T) {
+	dir := t.TempDir()
+
+	writeSamplePNG(t, filepath.Join(dir, "cute", "abc.png"))
+	writeSamplePNG(t, filepath.Join(dir, "pics", "my image.png"))
+	writeSamplePNG(t, filepath.Join(dir, ".thumbs", "pics", "my image.png.jpg"))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "report.json"), []byte("{}"), 0644))
+
+	require.NoError(t, metadata.Embed(filepath.Join(dir, "cute", "abc.png"), metadata.Metadata{
+		Title:     "A <cute> title",
+		Author:    "someone",
+		Subreddit: "cute",
+		Permalink: "https://www.reddit.com/r/cute/comments/abc/",
+	}))
+
+	require.NoError(t, Generate(Options{Directory: dir}))
+
+	index, err := os.ReadFile(filepath.Join(dir, "gallery", "index.html"))
+	require.NoError(t, err)
+	assert.Contains(t, string(index), `href="r-cute.html"`)
+	assert.Contains(t, string(index), `href="r-pics.html"`)
+	assert.NotContains(t, string(index), "r--thumbs")
+
+	cute, err := os.ReadFile(filepath.Join(dir, "gallery", "r-cute.html"))
+	require.NoError(t, err)
+	assert.Contains(t, string(cute), `src="../cute/abc.png"`)
+	assert.Contains(t, string(cute), `href="https://www.reddit.com/r/cute/comments/abc/"`)
+	assert.Contains(t, string(cute), "A &lt;cute&gt; title")
+	assert.Contains(t, string(cute), "u/someone")
+
+	pics, err := os.ReadFile(filepath.Join(dir, "gallery", "r-pics.html"))
+	require.NoError(t, err)
+	assert.Contains(t, string(pics), `href="../pics/my%20image.png"`)
+	assert.Contains(t, string(pics), `src="../.thumbs/pics/my%20image.png.jpg"`)
+
+	assert.FileExists(t, filepath.Join(dir, "gallery", "static", "gallery.css"))
+
+	// generating again should not pick up the gallery output itself.
+	require.NoError(t, Generate(Options{Directory: dir}))
+	groups, err := collectGroups(Options{Directory: dir, OutputDirectory: filepath.Join(dir, "gallery")})
+	require.NoError(t, err)
+	assert.Len(t, groups, 2)
+}
+
+// TestGenerateCollidingPages ensures folders that flatten into the same page name
+// are each given their own page.
+func TestGenerateCollidingPages(t *testing.T) {
+	dir := t.TempDir()
+
+	writeSamplePNG(t, filepath.Join(dir, "walls", "2024", "a.png"))
+	writeSamplePNG(t, filepath.Join(dir, "walls-2024", "b.png"))
+	writeSamplePNG(t, filepath.Join(dir, "Walls_2024", "c.png"))
+	writeSamplePNG(t, filepath.Join(dir, "walls_2024", "d.png"))
+
+	require.NoError(t, Generate(Options{Directory: dir}))
+
+	groups, err := collectGroups(Options{Directory: dir, OutputDirectory: filepath.Join(dir, "gallery")})
+	require.NoError(t, err)
+
+	pages := map[string]string{}
+
+	for _, group := range groups {
+		pages[group.Name] = group.Page
+	}
+
+	assert.Equal(t, map[string]string{
+		"Walls_2024": "r-Walls_2024.html",
+		"walls-2024": "r-walls-2024.html",
+		"walls/2024": "r-walls-2024-2.html",
+		"walls_2024": "r-walls_2024-2.html",
+	}, pages)
+
+	for name, file := range map[string]string{"r-walls-2024.html": "b.png", "r-walls-2024-2.html": "a.png",
+		"r-Walls_2024.html": "c.png", "r-walls_2024-2.html": "d.png"} {
+		page, err := os.ReadFile(filepath.Join(dir, "gallery", name))
+		require.NoError(t, err)
+		assert.Contains(t, string(page), file, name)
+	}
+}
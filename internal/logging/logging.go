@@ -0,0 +1,283 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// Level is the importance of a log event, events below the level of the logger
+// are dropped. The values match the levels of log/slog.
+type Level int
+
+const (
+	LevelDebug Level = -4
+	LevelInfo  Level = 0
+	LevelWarn  Level = 4
+	LevelError Level = 8
+)
+
+// String returns the upper case name of the level, as written into each event.
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelWarn:
+		return "WARN"
+	case LevelError:
+		return "ERROR"
+	}
+
+	return fmt.Sprintf("LEVEL(%d)", int(l))
+}
+
+// The formats events can be written in.
+const (
+	// FormatText writes each event as a line of key=value pairs, values
+	// containing spaces or quotes are quoted.
+	FormatText = "text"
+	// FormatJSON writes each event as a json object on its own line, suited for
+	// collection by a log pipeline.
+	FormatJSON = "json"
+)
+
+// Levels are the names of the supported levels, in order of importance.
+var Levels = []string{"debug", "info", "warn", "error"}
+
+// Formats are all the supported formats.
+var Formats = []string{FormatText, FormatJSON}
+
+var (
+	// ErrInvalidLevel is returned when parsing a level that is not supported.
+	ErrInvalidLevel = errors.New("invalid log level")
+	// ErrInvalidFormat is returned when creating a logger with a format that is
+	// not supported.
+	ErrInvalidFormat = errors.New("invalid log format")
+)
+
+// ParseLevel parses the level from its name, case insensitive.
+func ParseLevel(name string) (Level, error) {
+	switch strings.ToLower(name) {
+	case "debug":
+		return LevelDebug, nil
+	case "info":
+		return LevelInfo, nil
+	case "warn", "warning":
+		return LevelWarn, nil
+	case "error":
+		return LevelError, nil
+	}
+
+	return 0, fmt.Errorf("%w '%v', expected one of %v", ErrInvalidLevel, name, strings.Join(Levels, ", "))
+}
+
+// Logger writes structured events, a message along with key value pairs, at or
+// above its level. Loggers are safe for concurrent use and a nil logger discards
+// every event, so a logger is never required.
+type Logger struct {
+	// the writer events are written to, shared with every logger derived
+	// from this logger along with the mutex.
+	writer io.Writer
+	mutex  *sync.Mutex
+	format string
+	level  Level
+	// the key value pairs included with every event, added by With.
+	attrs []interface{}
+	// the source of the time of each event, replaced within tests.
+	now func() time.Time
+}
+
+// New creates a logger writing events at or above the level into the writer in
+// the given format, returning ErrInvalidFormat for a unsupported format.
+func New(writer io.Writer, format string, level Level) (*Logger, error) {
+	if format != FormatText && format != FormatJSON {
+		return nil, fmt.Errorf("%w '%v', expected one of %v", ErrInvalidFormat, format, strings.Join(Formats, ", "))
+	}
+
+	return &Logger{writer: writer, mutex: &sync.Mutex{}, format: format, level: level, now: time.Now}, nil
+}
+
+// Discard returns a logger that drops every event.
+func Discard() *Logger {
+	return nil
+}
+
+// With returns a logger that includes the given key value pairs with every
+// event, along with the pairs of this logger.
+func (l *Logger) With(args ...interface{}) *Logger {
+	if l == nil {
+		return nil
+	}
+
+	derived := *l
+	derived.attrs = append(append([]interface{}{}, l.attrs...), args...)
+	return &derived
+}
+
+// Enabled returns true if events at the given level would be written.
+func (l *Logger) Enabled(level Level) bool {
+	return l != nil && level >= l.level
+}
+
+// Debug writes a event at the debug level.
+func (l *Logger) Debug(msg string, args ...interface{}) {
+	l.Log(LevelDebug, msg, args...)
+}
+
+// Info writes a event at the info level.
+func (l *Logger) Info(msg string, args ...interface{}) {
+	l.Log(LevelInfo, msg, args...)
+}
+
+// Warn writes a event at the warn level.
+func (l *Logger) Warn(msg string, args ...interface{}) {
+	l.Log(LevelWarn, msg, args...)
+}
+
+// Error writes a event at the error level.
+func (l *Logger) Error(msg string, args ...interface{}) {
+	l.Log(LevelError, msg, args...)
+}
+
+// Log writes a event at the given level with the message and key value pairs,
+// e.g Log(LevelInfo, "downloaded image", "id", id, "bytes", 1024). A key without
+// a value (or a value in place of a key) is written under the !BADKEY key.
+func (l *Logger) Log(level Level, msg string, args ...interface{}) {
+	if !l.Enabled(level) {
+		return
+	}
+
+	pairs := []interface{}{"time", l.now(), "level", level.String(), "msg", msg}
+	pairs = append(pairs, l.attrs...)
+	pairs = append(pairs, args...)
+
+	var line bytes.Buffer
+
+	if l.format == FormatJSON {
+		writeJSON(&line, pairs)
+	} else {
+		writeText(&line, pairs)
+	}
+
+	line.WriteByte('\n')
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	_, _ = l.writer.Write(line.Bytes())
+}
+
+// forEachPair calls fn with each key and value of the pairs, using !BADKEY as
+// the key of values that are not preceded by a string key.
+func forEachPair(pairs []interface{}, fn func(key string, value interface{})) {
+	for i := 0; i < len(pairs); {
+		key, ok := pairs[i].(string)
+
+		if !ok || i+1 >= len(pairs) {
+			fn("!BADKEY", pairs[i])
+			i++
+			continue
+		}
+
+		fn(key, pairs[i+1])
+		i += 2
+	}
+}
+
+// writeText writes the pairs as space separated key=value pairs.
+func writeText(buffer *bytes.Buffer, pairs []interface{}) {
+	first := true
+
+	forEachPair(pairs, func(key string, value interface{}) {
+		if !first {
+			buffer.WriteByte(' ')
+		}
+
+		first = false
+		buffer.WriteString(quoteText(key))
+		buffer.WriteByte('=')
+		buffer.WriteString(quoteText(textValue(value)))
+	})
+}
+
+// textValue formats the value as written into a text event.
+func textValue(value interface{}) string {
+	switch v := value.(type) {
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case error:
+		return v.Error()
+	case nil:
+		return "<nil>"
+	}
+
+	return fmt.Sprint(value)
+}
+
+// quoteText quotes the value when it is empty or contains spaces, quotes, equal
+// signs or non printable characters, otherwise it would be ambiguous.
+func quoteText(value string) string {
+	if value == "" {
+		return `""`
+	}
+
+	for _, r := range value {
+		if unicode.IsSpace(r) || r == '"' || r == '=' || !unicode.IsPrint(r) {
+			return strconv.Quote(value)
+		}
+	}
+
+	return value
+}
+
+// writeJSON writes the pairs as a json object, keeping the order of the pairs.
+func writeJSON(buffer *bytes.Buffer, pairs []interface{}) {
+	buffer.WriteByte('{')
+	first := true
+
+	forEachPair(pairs, func(key string, value interface{}) {
+		if !first {
+			buffer.WriteByte(',')
+		}
+
+		first = false
+		encodedKey, _ := json.Marshal(key)
+		buffer.Write(encodedKey)
+		buffer.WriteByte(':')
+		buffer.Write(jsonValue(value))
+	})
+
+	buffer.WriteByte('}')
+}
+
+// jsonValue encodes the value as written into a json event, durations are
+// written as strings (e.g 1.5s) and errors as their message.
+func jsonValue(value interface{}) []byte {
+	switch v := value.(type) {
+	case time.Time:
+		value = v.Format(time.RFC3339Nano)
+	case time.Duration:
+		value = v.String()
+	case error:
+		value = v.Error()
+	case fmt.Stringer:
+		value = v.String()
+	}
+
+	encoded, err := json.Marshal(value)
+
+	if err != nil {
+		encoded, _ = json.Marshal(fmt.Sprint(value))
+	}
+
+	return encoded
+}
@@ -0,0 +1,75 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestLogger creates a logger writing into the returned buffer with a fixed time.
+func newTestLogger(t *testing.T, format string, level Level) (*Logger, *bytes.Buffer) {
+	var buffer bytes.Buffer
+	logger, err := New(&buffer, format, level)
+	require.NoError(t, err)
+
+	logger.now = func() time.Time { return time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC) }
+	return logger, &buffer
+}
+
+func TestParseLevel(t *testing.T) {
+	for name, expected := range map[string]Level{"debug": LevelDebug, "INFO": LevelInfo, "warn": LevelWarn,
+		"warning": LevelWarn, "error": LevelError} {
+		level, err := ParseLevel(name)
+		require.NoError(t, err, name)
+		assert.Equal(t, expected, level, name)
+	}
+
+	_, err := ParseLevel("verbose")
+	assert.ErrorIs(t, err, ErrInvalidLevel)
+}
+
+func TestNewInvalidFormat(t *testing.T) {
+	_, err := New(&bytes.Buffer{}, "xml", LevelInfo)
+	assert.ErrorIs(t, err, ErrInvalidFormat)
+}
+
+// TestText ensures events are written as key=value pairs, quoting values that
+// would otherwise be ambiguous and dropping events below the level.
+func TestText(t *testing.T) {
+	logger, buffer := newTestLogger(t, FormatText, LevelInfo)
+	logger = logger.With("subreddit", "cute")
+
+	logger.Debug("dropped")
+	logger.Info("downloaded image", "path", "cute/a b.jpg", "bytes", 1024, "duration", 1500*time.Millisecond)
+	logger.Error("failed", "error", errors.New(`status "404"`), "dangling")
+
+	assert.Equal(t, `time=2021-06-01T12:00:00Z level=INFO msg="downloaded image" subreddit=cute path="cute/a b.jpg" bytes=1024 duration=1.5s`+"\n"+
+		`time=2021-06-01T12:00:00Z level=ERROR msg=failed subreddit=cute error="status \"404\"" !BADKEY=dangling`+"\n",
+		buffer.String())
+}
+
+// TestJSON ensures events are written as a json object per line.
+func TestJSON(t *testing.T) {
+	logger, buffer := newTestLogger(t, FormatJSON, LevelDebug)
+
+	logger.Debug("downloading image", "id", "abc", "bytes", int64(10), "duration", time.Second, "ok", true)
+
+	assert.Equal(t, `{"time":"2021-06-01T12:00:00Z","level":"DEBUG","msg":"downloading image","id":"abc","bytes":10,"duration":"1s","ok":true}`+"\n",
+		buffer.String())
+
+	var event map[string]interface{}
+	require.NoError(t, json.Unmarshal(buffer.Bytes(), &event))
+}
+
+// TestNilLogger ensures a nil logger discards every event.
+func TestNilLogger(t *testing.T) {
+	var logger *Logger
+
+	assert.False(t, logger.Enabled(LevelError))
+	assert.NotPanics(t, func() { logger.With("key", "value").Error("dropped") })
+}
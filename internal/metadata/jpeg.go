@@ -0,0 +1,293 @@
+package metadata
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+)
+
+const (
+	markerSOI  = 0xD8
+	markerEOI  = 0xD9
+	markerSOS  = 0xDA
+	markerAPP0 = 0xE0
+	markerAPP1 = 0xE1
+)
+
+var (
+	// the identifiers that prefix the APP1 payload of a EXIF and XMP segment.
+	exifHeader = []byte("Exif\x00\x00")
+	xmpHeader  = []byte("http://ns.adobe.com/xap/1.0/\x00")
+
+	errInvalidJPEG = errors.New("metadata: invalid jpeg")
+)
+
+// jpegSegment is a single marker segment of a jpeg header, the data is the
+// payload of the segment excluding the marker and length bytes.
+type jpegSegment struct {
+	marker byte
+	data   []byte
+}
+
+// readJPEGSegments reads all the marker segments up until the start of scan,
+// leaving the reader positioned directly at the SOS marker so the entropy
+// coded image data can be copied through untouched.
+func readJPEGSegments(r *bufio.Reader) ([]jpegSegment, error) {
+	var soi [2]byte
+
+	if _, err := io.ReadFull(r, soi[:]); err != nil || soi[0] != 0xFF || soi[1] != markerSOI {
+		return nil, errInvalidJPEG
+	}
+
+	var segments []jpegSegment
+
+	for {
+		marker, err := r.Peek(2)
+
+		if err != nil {
+			return nil, errInvalidJPEG
+		}
+
+		if marker[0] != 0xFF {
+			return nil, errInvalidJPEG
+		}
+
+		// markers can be padded with any number of fill bytes, these carry no
+		// meaning and are dropped.
+		if marker[1] == 0xFF {
+			_, _ = r.Discard(1)
+			continue
+		}
+
+		if marker[1] == markerSOS || marker[1] == markerEOI {
+			return segments, nil
+		}
+
+		var header [4]byte
+
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			return nil, errInvalidJPEG
+		}
+
+		length := int(binary.BigEndian.Uint16(header[2:]))
+
+		if length < 2 {
+			return nil, errInvalidJPEG
+		}
+
+		data := make([]byte, length-2)
+
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, errInvalidJPEG
+		}
+
+		segments = append(segments, jpegSegment{marker: header[1], data: data})
+	}
+}
+
+// writeJPEGSegment writes a single marker segment, including the marker and
+// the length which includes the two length bytes themselves.
+func writeJPEGSegment(w io.Writer, s jpegSegment) error {
+	if len(s.data)+2 > 0xFFFF {
+		return fmt.Errorf("metadata: jpeg segment of %v bytes is too large", len(s.data))
+	}
+
+	header := []byte{0xFF, s.marker, 0, 0}
+	binary.BigEndian.PutUint16(header[2:], uint16(len(s.data)+2))
+
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+
+	_, err := w.Write(s.data)
+	return err
+}
+
+func isExifSegment(s jpegSegment) bool {
+	return s.marker == markerAPP1 && bytes.HasPrefix(s.data, exifHeader)
+}
+
+func isXMPSegment(s jpegSegment) bool {
+	return s.marker == markerAPP1 && bytes.HasPrefix(s.data, xmpHeader)
+}
+
+// embedJPEG rewrites the jpeg header segments with a XMP packet containing the
+// metadata, replacing any existing XMP packet. A minimal EXIF block is also
+// written but only when the file does not already contain one, since camera
+// EXIF data is far more valuable than the duplicated post information.
+func embedJPEG(in io.Reader, out io.Writer, m Metadata) error {
+	r := bufio.NewReader(in)
+	segments, err := readJPEGSegments(r)
+
+	if err != nil {
+		return err
+	}
+
+	var leading, trailing []jpegSegment
+	hasExif := false
+
+	// the JFIF and EXIF segments are expected to directly follow the start of
+	// image marker, so these are kept in front of the newly inserted segments.
+	for i, s := range segments {
+		if s.marker != markerAPP0 && !isExifSegment(s) {
+			trailing = segments[i:]
+			break
+		}
+
+		hasExif = hasExif || isExifSegment(s)
+		leading = append(leading, s)
+	}
+
+	if !hasExif {
+		leading = append(leading, jpegSegment{marker: markerAPP1, data: buildExif(m)})
+	}
+
+	leading = append(leading, jpegSegment{marker: markerAPP1, data: append(append([]byte{}, xmpHeader...), buildXMP(m)...)})
+
+	w := bufio.NewWriter(out)
+
+	if _, err := w.Write([]byte{0xFF, markerSOI}); err != nil {
+		return err
+	}
+
+	for _, s := range leading {
+		if err := writeJPEGSegment(w, s); err != nil {
+			return err
+		}
+	}
+
+	for _, s := range trailing {
+		if isXMPSegment(s) {
+			continue
+		}
+
+		if err := writeJPEGSegment(w, s); err != nil {
+			return err
+		}
+	}
+
+	// everything from the start of scan onwards is the encoded image data
+	// and is copied through exactly as it was read.
+	if _, err := io.Copy(w, r); err != nil {
+		return err
+	}
+
+	return w.Flush()
+}
+
+// readJPEG reads the metadata from the XMP packet of a jpeg file.
+func readJPEG(in io.Reader) (Metadata, error) {
+	segments, err := readJPEGSegments(bufio.NewReader(in))
+
+	if err != nil {
+		return Metadata{}, err
+	}
+
+	for _, s := range segments {
+		if isXMPSegment(s) {
+			return parseXMP(s.data[len(xmpHeader):])
+		}
+	}
+
+	return Metadata{}, nil
+}
+
+// xmpPacket is the subset of a XMP packet that is read back, the tags match on
+// local names so the prefixes used by other tools don't matter.
+type xmpPacket struct {
+	Description struct {
+		Title     []string `xml:"title>Alt>li"`
+		Creator   []string `xml:"creator>Seq>li"`
+		Source    string   `xml:"source"`
+		Subreddit string   `xml:"subreddit"`
+	} `xml:"RDF>Description"`
+}
+
+// buildXMP generates the XMP packet, dublin core is used for the title, author
+// and link while the sub reddit is stored under the mavic namespace.
+func buildXMP(m Metadata) []byte {
+	return []byte(fmt.Sprintf(`<?xpacket begin="%s" id="W5M0MpCehiHzreSzNTczkc9d"?>
+<x:xmpmeta xmlns:x="adobe:ns:meta/">
+ <rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+  <rdf:Description rdf:about="" xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:mavic="https://github.com/stephensli/mavic/ns/1.0/">
+   <dc:title><rdf:Alt><rdf:li xml:lang="x-default">%s</rdf:li></rdf:Alt></dc:title>
+   <dc:creator><rdf:Seq><rdf:li>%s</rdf:li></rdf:Seq></dc:creator>
+   <dc:source>%s</dc:source>
+   <mavic:subreddit>%s</mavic:subreddit>
+  </rdf:Description>
+ </rdf:RDF>
+</x:xmpmeta>
+<?xpacket end="w"?>`, "\uFEFF", html.EscapeString(m.Title), html.EscapeString(m.Author),
+		html.EscapeString(m.Permalink), html.EscapeString(m.Subreddit)))
+}
+
+func parseXMP(data []byte) (Metadata, error) {
+	var packet xmpPacket
+
+	if err := xml.Unmarshal(data, &packet); err != nil {
+		return Metadata{}, err
+	}
+
+	m := Metadata{Permalink: packet.Description.Source, Subreddit: packet.Description.Subreddit}
+
+	if len(packet.Description.Title) > 0 {
+		m.Title = packet.Description.Title[0]
+	}
+
+	if len(packet.Description.Creator) > 0 {
+		m.Author = packet.Description.Creator[0]
+	}
+
+	return m, nil
+}
+
+// buildExif generates a big endian EXIF block with a single IFD containing the
+// image description (title) and artist (author) tags.
+func buildExif(m Metadata) []byte {
+	type entry struct {
+		tag   uint16
+		value string
+	}
+
+	entries := []entry{{0x010E, m.Title}, {0x013B, m.Author}}
+
+	// tiff header (8) + entry count (2) + entries (12 each) + next ifd offset (4)
+	valueOffset := 8 + 2 + len(entries)*12 + 4
+
+	var ifd, values bytes.Buffer
+	_ = binary.Write(&ifd, binary.BigEndian, uint16(len(entries)))
+
+	for _, e := range entries {
+		value := append([]byte(e.value), 0)
+
+		_ = binary.Write(&ifd, binary.BigEndian, e.tag)
+		_ = binary.Write(&ifd, binary.BigEndian, uint16(2)) // ASCII
+		_ = binary.Write(&ifd, binary.BigEndian, uint32(len(value)))
+
+		// values of four bytes or less are stored directly in the entry.
+		if len(value) <= 4 {
+			padded := make([]byte, 4)
+			copy(padded, value)
+			ifd.Write(padded)
+			continue
+		}
+
+		_ = binary.Write(&ifd, binary.BigEndian, uint32(valueOffset+values.Len()))
+		values.Write(value)
+	}
+
+	_ = binary.Write(&ifd, binary.BigEndian, uint32(0))
+
+	var out bytes.Buffer
+	out.Write(exifHeader)
+	out.Write([]byte{'M', 'M', 0x00, 0x2A, 0x00, 0x00, 0x00, 0x08})
+	out.Write(ifd.Bytes())
+	out.Write(values.Bytes())
+
+	return out.Bytes()
+}
@@ -0,0 +1,157 @@
+package metadata
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// ErrUnsupportedFormat is returned when the given file is not a container that
+// metadata can be embedded into (e.g gif or webm), callers are expected to
+// treat this as a non-fatal outcome since the file itself is still valid.
+var ErrUnsupportedFormat = errors.New("metadata: unsupported file format")
+
+// Metadata is the reddit post information that will be written directly
+// into the downloaded file, allowing the file to keep its origin even
+// when it is copied away from the download directory.
+type Metadata struct {
+	// The title of the reddit post the file was linked from.
+	Title string
+	// The reddit username of the user who created the post.
+	Author string
+	// The sub reddit in which the post was made.
+	Subreddit string
+	// The full link to the reddit post (not the media link).
+	Permalink string
+}
+
+// format is the container type determined from the leading magic bytes
+// of a file, used to route embedding and reading to the right writer.
+type format int
+
+const (
+	unknownFormat format = iota
+	jpegFormat
+	pngFormat
+	mp4Format
+)
+
+// detectFormat determines the container format from the header bytes of a
+// file over the extension, since reddit and imgur links are not always
+// truthful about the content behind them.
+func detectFormat(header []byte) format {
+	switch {
+	case len(header) >= 3 && bytes.Equal(header[:3], []byte{0xFF, 0xD8, 0xFF}):
+		return jpegFormat
+	case len(header) >= 8 && bytes.Equal(header[:8], pngSignature):
+		return pngFormat
+	case len(header) >= 8 && string(header[4:8]) == "ftyp":
+		return mp4Format
+	}
+
+	return unknownFormat
+}
+
+// Embed writes the given metadata into the file at the given path. JPEG files
+// get XMP (and EXIF when no EXIF exists), PNG files get iTXt chunks and MP4
+// files get iTunes style metadata atoms. Only metadata segments are added or
+// replaced, the encoded image or video data is left byte-for-byte untouched.
+func Embed(path string, m Metadata) error {
+	in, err := os.Open(path)
+
+	if err != nil {
+		return err
+	}
+
+	defer in.Close()
+
+	info, err := in.Stat()
+
+	if err != nil {
+		return err
+	}
+
+	header := make([]byte, 12)
+	n, _ := io.ReadFull(in, header)
+	fileFormat := detectFormat(header[:n])
+
+	if fileFormat == unknownFormat {
+		return ErrUnsupportedFormat
+	}
+
+	if _, err := in.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	// the embedded output is written to a temporary file in the same directory
+	// and renamed over the original, ensuring a failure part way through never
+	// leaves a half written file in place of a good one.
+	out, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.meta")
+
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(out.Name())
+
+	// temporary files are created readable only by the owner, so the mode of
+	// the original is kept, otherwise embedding would narrow the permissions.
+	if err := out.Chmod(info.Mode().Perm()); err != nil {
+		_ = out.Close()
+		return err
+	}
+
+	switch fileFormat {
+	case jpegFormat:
+		err = embedJPEG(in, out, m)
+	case pngFormat:
+		err = embedPNG(in, out, m)
+	case mp4Format:
+		err = embedMP4(in, out, m)
+	}
+
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return err
+	}
+
+	// windows does not allow renaming over a file that is still open.
+	_ = in.Close()
+	return os.Rename(out.Name(), path)
+}
+
+// Read reads back the metadata that was embedded into the file at the given
+// path by Embed. A file without any embedded metadata returns an empty
+// Metadata and no error.
+func Read(path string) (Metadata, error) {
+	in, err := os.Open(path)
+
+	if err != nil {
+		return Metadata{}, err
+	}
+
+	defer in.Close()
+
+	header := make([]byte, 12)
+	n, _ := io.ReadFull(in, header)
+
+	if _, err := in.Seek(0, io.SeekStart); err != nil {
+		return Metadata{}, err
+	}
+
+	switch detectFormat(header[:n]) {
+	case jpegFormat:
+		return readJPEG(in)
+	case pngFormat:
+		return readPNG(in)
+	case mp4Format:
+		return readMP4(in)
+	}
+
+	return Metadata{}, ErrUnsupportedFormat
+}
@@ -0,0 +1,186 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var sampleMetadata = Metadata{
+	Title:     "Army Crawling <Basic> Training & more ✓",
+	Author:    "unknown",
+	Subreddit: "cute",
+	Permalink: "https://www.reddit.com/r/cute/comments/d4zpeh/arm_crawling_basic_training/",
+}
+
+// sampleImage generates a small image with a gradient so that any change to
+// the encoded pixel data would be noticeable once decoded.
+func sampleImage() image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, 16, 16))
+
+	for x := 0; x < 16; x++ {
+		for y := 0; y < 16; y++ {
+			img.Set(x, y, color.RGBA{R: uint8(x * 16), G: uint8(y * 16), B: 128, A: 255})
+		}
+	}
+
+	return img
+}
+
+func writeTempFile(t *testing.T, name string, data []byte) string {
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, data, 0644))
+	return path
+}
+
+// TestEmbedJPEG ensures the metadata can be read back after embedding and that
+// the entropy coded image data is the exact same bytes as before.
+func TestEmbedJPEG(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, jpeg.Encode(&buf, sampleImage(), nil))
+	original := buf.Bytes()
+
+	path := writeTempFile(t, "image.jpg", original)
+	require.NoError(t, Embed(path, sampleMetadata))
+
+	// embedding twice should replace the existing packet, not add another.
+	require.NoError(t, Embed(path, sampleMetadata))
+
+	embedded, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	sos := []byte{0xFF, markerSOS}
+	assert.Equal(t, original[bytes.Index(original, sos):], embedded[bytes.Index(embedded, sos):])
+	assert.Equal(t, 1, bytes.Count(embedded, xmpHeader))
+	assert.Equal(t, 1, bytes.Count(embedded, exifHeader))
+
+	read, err := Read(path)
+	require.NoError(t, err)
+	assert.Equal(t, sampleMetadata, read)
+
+	_, err = jpeg.Decode(bytes.NewReader(embedded))
+	assert.NoError(t, err)
+}
+
+// TestEmbedKeepsMode ensures the file keeps its permissions after embedding, even
+// though the output is written to a temporary file first.
+func TestEmbedKeepsMode(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, jpeg.Encode(&buf, sampleImage(), nil))
+
+	path := writeTempFile(t, "image.jpg", buf.Bytes())
+	require.NoError(t, os.Chmod(path, 0644))
+	require.NoError(t, Embed(path, sampleMetadata))
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0644), info.Mode().Perm())
+}
+
+// TestEmbedPNG ensures the metadata is written as text chunks and that all
+// the original chunks (including the image data) are kept as is.
+func TestEmbedPNG(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, sampleImage()))
+	original := buf.Bytes()
+
+	path := writeTempFile(t, "image.png", original)
+	require.NoError(t, Embed(path, sampleMetadata))
+	require.NoError(t, Embed(path, sampleMetadata))
+
+	embedded, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	// everything but the trailing IEND chunk should be a prefix of the output.
+	iend := len(original) - 12
+	assert.Equal(t, original[:iend], embedded[:iend])
+	assert.Equal(t, original[iend:], embedded[len(embedded)-12:])
+	assert.Equal(t, 4, bytes.Count(embedded, []byte("iTXt")))
+
+	read, err := Read(path)
+	require.NoError(t, err)
+	assert.Equal(t, sampleMetadata, read)
+
+	decoded, err := png.Decode(bytes.NewReader(embedded))
+	require.NoError(t, err)
+	assert.Equal(t, sampleImage().(*image.RGBA).Pix, decoded.(*image.RGBA).Pix)
+}
+
+// sampleMP4 builds a minimal fast start mp4 with the moov box before the mdat
+// box, with a single chunk offset pointing at the start of the media data.
+func sampleMP4(payload []byte) []byte {
+	ftyp := encodeMP4Box("ftyp", []byte("isom\x00\x00\x02\x00isomiso2mp41"))
+
+	stco := func(offset uint32) []byte {
+		data := []byte{0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 0}
+		binary.BigEndian.PutUint32(data[8:], offset)
+		return encodeMP4Box("stco", data)
+	}
+
+	moov := func(offset uint32) []byte {
+		stbl := encodeMP4Box("stbl", stco(offset))
+		minf := encodeMP4Box("minf", stbl)
+		mdia := encodeMP4Box("mdia", minf)
+		trak := encodeMP4Box("trak", mdia)
+		return encodeMP4Box("moov", append(encodeMP4Box("mvhd", make([]byte, 100)), trak...))
+	}
+
+	// the offset is the position of the mdat payload, after ftyp, moov and
+	// the mdat header.
+	offset := uint32(len(ftyp) + len(moov(0)) + 8)
+
+	out := append(ftyp, moov(offset)...)
+	return append(out, encodeMP4Box("mdat", payload)...)
+}
+
+// chunkOffset returns the first chunk offset of the first track.
+func chunkOffset(t *testing.T, data []byte) uint32 {
+	idx := bytes.Index(data, []byte("stco"))
+	require.NotEqual(t, -1, idx)
+	return binary.BigEndian.Uint32(data[idx+12:])
+}
+
+// TestEmbedMP4 ensures the metadata is stored in the moov box and that the
+// chunk offsets still point at the exact same media bytes after the moov box
+// has grown.
+func TestEmbedMP4(t *testing.T) {
+	payload := []byte("this is the video payload that must stay put")
+	original := sampleMP4(payload)
+
+	path := writeTempFile(t, "video.mp4", original)
+	require.NoError(t, Embed(path, sampleMetadata))
+	require.NoError(t, Embed(path, sampleMetadata))
+
+	embedded, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	offset := chunkOffset(t, embedded)
+	assert.Equal(t, payload, embedded[offset:offset+uint32(len(payload))])
+	assert.Equal(t, 1, bytes.Count(embedded, []byte("ilst")))
+
+	read, err := Read(path)
+	require.NoError(t, err)
+	assert.Equal(t, sampleMetadata, read)
+}
+
+// TestEmbedUnsupported ensures formats that cannot hold metadata are reported
+// as unsupported and left untouched.
+func TestEmbedUnsupported(t *testing.T) {
+	original := []byte("GIF89a not really a gif")
+	path := writeTempFile(t, "image.gif", original)
+
+	assert.ErrorIs(t, Embed(path, sampleMetadata), ErrUnsupportedFormat)
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, original, data)
+}
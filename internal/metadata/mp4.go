@@ -0,0 +1,451 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+var errInvalidMP4 = errors.New("metadata: invalid mp4")
+
+// The iTunes style item list atoms used to store the metadata.
+const (
+	mp4TitleAtom     = "\xA9nam"
+	mp4AuthorAtom    = "\xA9ART"
+	mp4SubredditAtom = "\xA9alb"
+	mp4PermalinkAtom = "\xA9cmt"
+)
+
+// mp4Box is a box that has been fully read into memory, only the moov box and
+// its children are ever held in memory, the media data is streamed.
+type mp4Box struct {
+	typ  string
+	data []byte
+}
+
+// mp4BoxHeader is the header of a top level box, size is the full size of the
+// box including the header, with a size of -1 marking a box up to the end of
+// the file.
+type mp4BoxHeader struct {
+	typ        string
+	size       int64
+	headerSize int64
+}
+
+func readMP4BoxHeader(r io.Reader) (mp4BoxHeader, error) {
+	var header [8]byte
+
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return mp4BoxHeader{}, err
+	}
+
+	h := mp4BoxHeader{
+		typ:        string(header[4:]),
+		size:       int64(binary.BigEndian.Uint32(header[:4])),
+		headerSize: 8,
+	}
+
+	switch h.size {
+	case 0:
+		h.size = -1
+	case 1:
+		var large [8]byte
+
+		if _, err := io.ReadFull(r, large[:]); err != nil {
+			return mp4BoxHeader{}, errInvalidMP4
+		}
+
+		h.size = int64(binary.BigEndian.Uint64(large[:]))
+		h.headerSize = 16
+	}
+
+	if h.size != -1 && h.size < h.headerSize {
+		return mp4BoxHeader{}, errInvalidMP4
+	}
+
+	return h, nil
+}
+
+// parseMP4Boxes parses a in memory sequence of boxes, used for the children
+// of a container box.
+func parseMP4Boxes(data []byte) ([]mp4Box, error) {
+	var boxes []mp4Box
+
+	for len(data) > 0 {
+		h, err := readMP4BoxHeader(bytes.NewReader(data))
+
+		if err != nil {
+			return nil, errInvalidMP4
+		}
+
+		if h.size == -1 {
+			h.size = int64(len(data))
+		}
+
+		if h.size > int64(len(data)) {
+			return nil, errInvalidMP4
+		}
+
+		boxes = append(boxes, mp4Box{typ: h.typ, data: data[h.headerSize:h.size]})
+		data = data[h.size:]
+	}
+
+	return boxes, nil
+}
+
+func encodeMP4Box(typ string, data []byte) []byte {
+	out := make([]byte, 8, 8+len(data))
+	binary.BigEndian.PutUint32(out, uint32(8+len(data)))
+	copy(out[4:], typ)
+	return append(out, data...)
+}
+
+func encodeMP4Boxes(boxes []mp4Box) []byte {
+	var out []byte
+
+	for _, b := range boxes {
+		out = append(out, encodeMP4Box(b.typ, b.data)...)
+	}
+
+	return out
+}
+
+// metaChildren returns the children of a meta box, the iso specification has
+// the meta box as a full box with version and flags while quicktime files
+// omit them, the presence of the hdlr box is used to tell them apart.
+func metaChildren(data []byte) ([]mp4Box, error) {
+	if len(data) >= 8 && string(data[4:8]) == "hdlr" {
+		return parseMP4Boxes(data)
+	}
+
+	if len(data) < 4 {
+		return nil, errInvalidMP4
+	}
+
+	return parseMP4Boxes(data[4:])
+}
+
+// buildMP4Meta builds the meta box containing the handler and item list.
+func buildMP4Meta(m Metadata) []byte {
+	item := func(typ, value string) mp4Box {
+		// data atom: type indicator of 1 (utf-8) and a zero locale.
+		data := append([]byte{0, 0, 0, 1, 0, 0, 0, 0}, value...)
+		return mp4Box{typ: typ, data: encodeMP4Box("data", data)}
+	}
+
+	ilst := encodeMP4Boxes([]mp4Box{
+		item(mp4TitleAtom, m.Title),
+		item(mp4AuthorAtom, m.Author),
+		item(mp4SubredditAtom, m.Subreddit),
+		item(mp4PermalinkAtom, m.Permalink),
+	})
+
+	// version and flags, pre defined, handler type, three reserved and a empty name.
+	hdlr := append([]byte{0, 0, 0, 0, 0, 0, 0, 0}, "mdir"...)
+	hdlr = append(hdlr, "appl"...)
+	hdlr = append(hdlr, make([]byte, 9)...)
+
+	meta := []byte{0, 0, 0, 0}
+	meta = append(meta, encodeMP4Box("hdlr", hdlr)...)
+	meta = append(meta, encodeMP4Box("ilst", ilst)...)
+
+	return meta
+}
+
+// rewriteMoov returns the moov box payload with the metadata placed into the
+// user data box, replacing any existing meta box while keeping all the other
+// user data.
+func rewriteMoov(moov []byte, m Metadata) ([]byte, error) {
+	children, err := parseMP4Boxes(moov)
+
+	if err != nil {
+		return nil, err
+	}
+
+	meta := mp4Box{typ: "meta", data: buildMP4Meta(m)}
+	hasUdta := false
+
+	for i, child := range children {
+		if child.typ != "udta" {
+			continue
+		}
+
+		udtaChildren, err := parseMP4Boxes(child.data)
+
+		if err != nil {
+			return nil, err
+		}
+
+		var kept []mp4Box
+
+		for _, u := range udtaChildren {
+			if u.typ != "meta" {
+				kept = append(kept, u)
+			}
+		}
+
+		children[i].data = encodeMP4Boxes(append(kept, meta))
+		hasUdta = true
+	}
+
+	if !hasUdta {
+		children = append(children, mp4Box{typ: "udta", data: encodeMP4Box(meta.typ, meta.data)})
+	}
+
+	return encodeMP4Boxes(children), nil
+}
+
+// shiftChunkOffsets adjusts every chunk offset (stco and co64) within the moov
+// box by the given delta. This is required when the moov box precedes the
+// media data and changes size, since the offsets are absolute file positions.
+func shiftChunkOffsets(moov []byte, delta int64) ([]byte, error) {
+	children, err := parseMP4Boxes(moov)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for i, child := range children {
+		switch child.typ {
+		case "trak", "mdia", "minf", "stbl":
+			shifted, err := shiftChunkOffsets(child.data, delta)
+
+			if err != nil {
+				return nil, err
+			}
+
+			children[i].data = shifted
+		case "stco", "co64":
+			if len(child.data) < 8 {
+				return nil, errInvalidMP4
+			}
+
+			entrySize := 4
+
+			if child.typ == "co64" {
+				entrySize = 8
+			}
+
+			count := int(binary.BigEndian.Uint32(child.data[4:8]))
+			table := child.data[8:]
+
+			if len(table) < count*entrySize {
+				return nil, errInvalidMP4
+			}
+
+			for e := 0; e < count; e++ {
+				entry := table[e*entrySize:]
+
+				if entrySize == 8 {
+					binary.BigEndian.PutUint64(entry, uint64(int64(binary.BigEndian.Uint64(entry))+delta))
+					continue
+				}
+
+				offset := int64(binary.BigEndian.Uint32(entry)) + delta
+
+				if offset < 0 || offset > math.MaxUint32 {
+					return nil, fmt.Errorf("metadata: chunk offset %v out of range for stco", offset)
+				}
+
+				binary.BigEndian.PutUint32(entry, uint32(offset))
+			}
+		}
+	}
+
+	return encodeMP4Boxes(children), nil
+}
+
+// embedMP4 streams the top level boxes through, only the moov box is read into
+// memory and rewritten with the metadata. Media data is copied untouched.
+func embedMP4(in io.ReadSeeker, out io.Writer, m Metadata) error {
+	seenMdat := false
+	written := false
+
+	for {
+		h, err := readMP4BoxHeader(in)
+
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return errInvalidMP4
+		}
+
+		if h.typ != "moov" {
+			seenMdat = seenMdat || h.typ == "mdat"
+
+			if _, err := in.Seek(-h.headerSize, io.SeekCurrent); err != nil {
+				return err
+			}
+
+			if h.size == -1 {
+				_, err = io.Copy(out, in)
+				return err
+			}
+
+			if _, err := io.CopyN(out, in, h.size); err != nil {
+				return errInvalidMP4
+			}
+
+			continue
+		}
+
+		if h.size == -1 {
+			return errInvalidMP4
+		}
+
+		moov := make([]byte, h.size-h.headerSize)
+
+		if _, err := io.ReadFull(in, moov); err != nil {
+			return errInvalidMP4
+		}
+
+		rewritten, err := rewriteMoov(moov, m)
+
+		if err != nil {
+			return err
+		}
+
+		// when the moov box comes before the media data (fast start files), the
+		// media data moves by however much the moov box grew or shrunk.
+		if !seenMdat {
+			rewritten, err = shiftChunkOffsets(rewritten, int64(len(rewritten)+8)-h.size)
+
+			if err != nil {
+				return err
+			}
+		}
+
+		if _, err := out.Write(encodeMP4Box("moov", rewritten)); err != nil {
+			return err
+		}
+
+		written = true
+	}
+
+	if !written {
+		return errInvalidMP4
+	}
+
+	return nil
+}
+
+// readMP4 reads the metadata from the item list of the moov user data box.
+func readMP4(in io.ReadSeeker) (Metadata, error) {
+	for {
+		h, err := readMP4BoxHeader(in)
+
+		if err != nil {
+			return Metadata{}, errInvalidMP4
+		}
+
+		if h.typ != "moov" {
+			if h.size == -1 {
+				return Metadata{}, errInvalidMP4
+			}
+
+			if _, err := in.Seek(h.size-h.headerSize, io.SeekCurrent); err != nil {
+				return Metadata{}, err
+			}
+
+			continue
+		}
+
+		if h.size == -1 {
+			return Metadata{}, errInvalidMP4
+		}
+
+		moov := make([]byte, h.size-h.headerSize)
+
+		if _, err := io.ReadFull(in, moov); err != nil {
+			return Metadata{}, errInvalidMP4
+		}
+
+		return parseMP4Metadata(moov)
+	}
+}
+
+func parseMP4Metadata(moov []byte) (Metadata, error) {
+	var m Metadata
+
+	find := func(boxes []mp4Box, typ string) (mp4Box, bool) {
+		for _, b := range boxes {
+			if b.typ == typ {
+				return b, true
+			}
+		}
+
+		return mp4Box{}, false
+	}
+
+	children, err := parseMP4Boxes(moov)
+
+	if err != nil {
+		return m, err
+	}
+
+	udta, ok := find(children, "udta")
+
+	if !ok {
+		return m, nil
+	}
+
+	if children, err = parseMP4Boxes(udta.data); err != nil {
+		return m, err
+	}
+
+	meta, ok := find(children, "meta")
+
+	if !ok {
+		return m, nil
+	}
+
+	if children, err = metaChildren(meta.data); err != nil {
+		return m, err
+	}
+
+	ilst, ok := find(children, "ilst")
+
+	if !ok {
+		return m, nil
+	}
+
+	items, err := parseMP4Boxes(ilst.data)
+
+	if err != nil {
+		return m, err
+	}
+
+	for _, item := range items {
+		dataBoxes, err := parseMP4Boxes(item.data)
+
+		if err != nil {
+			return m, err
+		}
+
+		data, ok := find(dataBoxes, "data")
+
+		if !ok || len(data.data) < 8 {
+			continue
+		}
+
+		value := string(data.data[8:])
+
+		switch item.typ {
+		case mp4TitleAtom:
+			m.Title = value
+		case mp4AuthorAtom:
+			m.Author = value
+		case mp4SubredditAtom:
+			m.Subreddit = value
+		case mp4PermalinkAtom:
+			m.Permalink = value
+		}
+	}
+
+	return m, nil
+}
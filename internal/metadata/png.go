@@ -0,0 +1,226 @@
+package metadata
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+)
+
+var (
+	pngSignature  = []byte{0x89, 'P', 'N', 'G', '\r', '\n', 0x1A, '\n'}
+	errInvalidPNG = errors.New("metadata: invalid png")
+)
+
+// The iTXt keywords used to store the metadata. Title and Author are registered
+// png keywords, the remaining are specific to mavic.
+const (
+	pngTitleKeyword     = "Title"
+	pngAuthorKeyword    = "Author"
+	pngSubredditKeyword = "Subreddit"
+	pngPermalinkKeyword = "Permalink"
+)
+
+// pngChunk is a single png chunk, the crc is recalculated on write so is
+// not stored.
+type pngChunk struct {
+	typ  string
+	data []byte
+}
+
+// readPNGChunk reads the next chunk from the reader, validating the crc so
+// corrupt files are not rewritten with a freshly calculated valid crc.
+func readPNGChunk(r io.Reader) (pngChunk, error) {
+	var header [8]byte
+
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return pngChunk{}, errInvalidPNG
+	}
+
+	data := make([]byte, binary.BigEndian.Uint32(header[:4]))
+
+	if _, err := io.ReadFull(r, data); err != nil {
+		return pngChunk{}, errInvalidPNG
+	}
+
+	var crc [4]byte
+
+	if _, err := io.ReadFull(r, crc[:]); err != nil {
+		return pngChunk{}, errInvalidPNG
+	}
+
+	chunk := pngChunk{typ: string(header[4:]), data: data}
+
+	if binary.BigEndian.Uint32(crc[:]) != chunkCRC(chunk) {
+		return pngChunk{}, errInvalidPNG
+	}
+
+	return chunk, nil
+}
+
+func writePNGChunk(w io.Writer, c pngChunk) error {
+	var header [8]byte
+	binary.BigEndian.PutUint32(header[:4], uint32(len(c.data)))
+	copy(header[4:], c.typ)
+
+	var crc [4]byte
+	binary.BigEndian.PutUint32(crc[:], chunkCRC(c))
+
+	for _, b := range [][]byte{header[:], c.data, crc[:]} {
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func chunkCRC(c pngChunk) uint32 {
+	crc := crc32.NewIEEE()
+	_, _ = crc.Write([]byte(c.typ))
+	_, _ = crc.Write(c.data)
+	return crc.Sum32()
+}
+
+// newITXtChunk creates a uncompressed international text chunk, iTXt is used
+// over tEXt since post titles are commonly not latin-1.
+func newITXtChunk(keyword, text string) pngChunk {
+	var data bytes.Buffer
+	data.WriteString(keyword)
+	// null separator, compression flag, compression method, empty language
+	// tag and empty translated keyword, each of the strings null terminated.
+	data.Write([]byte{0, 0, 0, 0, 0})
+	data.WriteString(text)
+
+	return pngChunk{typ: "iTXt", data: data.Bytes()}
+}
+
+// parseTextChunk returns the keyword and text of a tEXt or iTXt chunk,
+// compressed iTXt chunks are not written by mavic and are ignored.
+func parseTextChunk(c pngChunk) (string, string, bool) {
+	parts := bytes.SplitN(c.data, []byte{0}, 2)
+
+	if len(parts) != 2 {
+		return "", "", false
+	}
+
+	if c.typ == "tEXt" {
+		return string(parts[0]), string(parts[1]), true
+	}
+
+	if c.typ != "iTXt" || len(parts[1]) < 2 || parts[1][0] != 0 {
+		return "", "", false
+	}
+
+	// skip the compression flag and method, then the language tag and the
+	// translated keyword to get to the text.
+	rest := bytes.SplitN(parts[1][2:], []byte{0}, 3)
+
+	if len(rest) != 3 {
+		return "", "", false
+	}
+
+	return string(parts[0]), string(rest[2]), true
+}
+
+func isMetadataKeyword(keyword string) bool {
+	switch keyword {
+	case pngTitleKeyword, pngAuthorKeyword, pngSubredditKeyword, pngPermalinkKeyword:
+		return true
+	}
+
+	return false
+}
+
+// embedPNG copies all the chunks through untouched, dropping any previously
+// embedded metadata chunks and writing the new chunks directly before IEND.
+func embedPNG(in io.Reader, out io.Writer, m Metadata) error {
+	r := bufio.NewReader(in)
+	signature := make([]byte, len(pngSignature))
+
+	if _, err := io.ReadFull(r, signature); err != nil || !bytes.Equal(signature, pngSignature) {
+		return errInvalidPNG
+	}
+
+	w := bufio.NewWriter(out)
+
+	if _, err := w.Write(pngSignature); err != nil {
+		return err
+	}
+
+	for {
+		chunk, err := readPNGChunk(r)
+
+		if err != nil {
+			return err
+		}
+
+		if keyword, _, ok := parseTextChunk(chunk); ok && isMetadataKeyword(keyword) {
+			continue
+		}
+
+		if chunk.typ == "IEND" {
+			textChunks := []pngChunk{
+				newITXtChunk(pngTitleKeyword, m.Title),
+				newITXtChunk(pngAuthorKeyword, m.Author),
+				newITXtChunk(pngSubredditKeyword, m.Subreddit),
+				newITXtChunk(pngPermalinkKeyword, m.Permalink),
+			}
+
+			for _, c := range append(textChunks, chunk) {
+				if err := writePNGChunk(w, c); err != nil {
+					return err
+				}
+			}
+
+			return w.Flush()
+		}
+
+		if err := writePNGChunk(w, chunk); err != nil {
+			return err
+		}
+	}
+}
+
+// readPNG reads the metadata back from the text chunks of a png file.
+func readPNG(in io.Reader) (Metadata, error) {
+	r := bufio.NewReader(in)
+	signature := make([]byte, len(pngSignature))
+
+	if _, err := io.ReadFull(r, signature); err != nil || !bytes.Equal(signature, pngSignature) {
+		return Metadata{}, errInvalidPNG
+	}
+
+	var m Metadata
+
+	for {
+		chunk, err := readPNGChunk(r)
+
+		if err != nil {
+			return Metadata{}, err
+		}
+
+		if chunk.typ == "IEND" {
+			return m, nil
+		}
+
+		keyword, text, ok := parseTextChunk(chunk)
+
+		if !ok {
+			continue
+		}
+
+		switch keyword {
+		case pngTitleKeyword:
+			m.Title = text
+		case pngAuthorKeyword:
+			m.Author = text
+		case pngSubredditKeyword:
+			m.Subreddit = text
+		case pngPermalinkKeyword:
+			m.Permalink = text
+		}
+	}
+}
@@ -0,0 +1,311 @@
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// contentType is the content type of the prometheus text exposition format.
+const contentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefaultBuckets are the upper bounds (in seconds) of the histogram buckets
+// suited for request latencies, the same as the prometheus client defaults.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// metric is a counter or histogram that can be written in the text format.
+type metric interface {
+	write(buffer *bytes.Buffer)
+}
+
+// Registry holds the counters and histograms exposed to prometheus, written in
+// the order they were created. The registry is a http handler serving every
+// metric in the prometheus text exposition format.
+type Registry struct {
+	mutex   sync.Mutex
+	metrics []metric
+}
+
+// NewRegistry creates a empty registry.
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Counter creates and registers a counter with the given label names.
+func (r *Registry) Counter(name string, help string, labels ...string) *Counter {
+	counter := &Counter{family: family{name: name, help: help, labels: labels}, series: map[string]*counterSeries{}}
+	r.register(counter)
+	return counter
+}
+
+// Histogram creates and registers a histogram with the given bucket upper bounds
+// (sorted in increasing order) and label names.
+func (r *Registry) Histogram(name string, help string, buckets []float64, labels ...string) *Histogram {
+	histogram := &Histogram{family: family{name: name, help: help, labels: labels}, buckets: buckets,
+		series: map[string]*histogramSeries{}}
+	r.register(histogram)
+	return histogram
+}
+
+func (r *Registry) register(m metric) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.metrics = append(r.metrics, m)
+}
+
+// WriteTo writes every metric in the prometheus text exposition format.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mutex.Lock()
+	metrics := append([]metric{}, r.metrics...)
+	r.mutex.Unlock()
+
+	var buffer bytes.Buffer
+
+	for _, m := range metrics {
+		m.write(&buffer)
+	}
+
+	return buffer.WriteTo(w)
+}
+
+// ServeHTTP serves every metric in the prometheus text exposition format.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", contentType)
+	_, _ = r.WriteTo(w)
+}
+
+// family is the name, help and label names shared by every series of a metric.
+type family struct {
+	name   string
+	help   string
+	labels []string
+}
+
+// writeHeader writes the help and type lines of the metric.
+func (f family) writeHeader(buffer *bytes.Buffer, typ string) {
+	fmt.Fprintf(buffer, "# HELP %v %v\n", f.name, strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(f.help))
+	fmt.Fprintf(buffer, "# TYPE %v %v\n", f.name, typ)
+}
+
+// key returns the key of the series with the given label values, panicking when
+// the number of values does not match the label names since that is a bug.
+func (f family) key(values []string) string {
+	if len(values) != len(f.labels) {
+		panic(fmt.Sprintf("metric %v expects %v label values, got %v", f.name, len(f.labels), len(values)))
+	}
+
+	return strings.Join(values, "\xff")
+}
+
+// formatLabels formats the label names and values as written after the metric
+// name, including any extra label (e.g the le of a histogram bucket).
+func (f family) formatLabels(values []string, extra ...string) string {
+	pairs := make([]string, 0, len(f.labels)+len(extra)/2)
+
+	for i, name := range f.labels {
+		pairs = append(pairs, fmt.Sprintf(`%v="%v"`, name, escapeLabel(values[i])))
+	}
+
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, fmt.Sprintf(`%v="%v"`, extra[i], escapeLabel(extra[i+1])))
+	}
+
+	if len(pairs) == 0 {
+		return ""
+	}
+
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// escapeLabel escapes the backslashes, quotes and new lines of a label value.
+func escapeLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+// formatFloat formats the value as written into the text format.
+func formatFloat(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// sortedKeys returns the keys of the series in order, keeping the output stable.
+func sortedKeys(keys []string) []string {
+	sort.Strings(keys)
+	return keys
+}
+
+// Counter is a value that only goes up, split into a series per label values.
+type Counter struct {
+	family
+	mutex  sync.Mutex
+	series map[string]*counterSeries
+}
+
+type counterSeries struct {
+	labels []string
+	value  float64
+}
+
+// Add adds the value (which must not be negative) to the series of the given
+// label values. Adding zero creates the series, so it is exposed before the
+// first event.
+func (c *Counter) Add(value float64, labels ...string) {
+	if value < 0 {
+		return
+	}
+
+	key := c.key(labels)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	series, ok := c.series[key]
+
+	if !ok {
+		series = &counterSeries{labels: append([]string{}, labels...)}
+		c.series[key] = series
+	}
+
+	series.value += value
+}
+
+// Inc adds one to the series of the given label values.
+func (c *Counter) Inc(labels ...string) {
+	c.Add(1, labels...)
+}
+
+// Value returns the current value of the series of the given label values.
+func (c *Counter) Value(labels ...string) float64 {
+	key := c.key(labels)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if series, ok := c.series[key]; ok {
+		return series.value
+	}
+
+	return 0
+}
+
+func (c *Counter) write(buffer *bytes.Buffer) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.writeHeader(buffer, "counter")
+
+	// a counter without labels always has its single series.
+	if len(c.labels) == 0 && len(c.series) == 0 {
+		fmt.Fprintf(buffer, "%v 0\n", c.name)
+		return
+	}
+
+	keys := make([]string, 0, len(c.series))
+
+	for key := range c.series {
+		keys = append(keys, key)
+	}
+
+	for _, key := range sortedKeys(keys) {
+		series := c.series[key]
+		fmt.Fprintf(buffer, "%v%v %v\n", c.name, c.formatLabels(series.labels), formatFloat(series.value))
+	}
+}
+
+// Histogram counts observed values into buckets, along with the sum and count of
+// every observation, split into a series per label values.
+type Histogram struct {
+	family
+	buckets []float64
+	mutex   sync.Mutex
+	series  map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	labels []string
+	// the number of observations within each bucket (not cumulative), the
+	// observations above the last bucket are only within the count.
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// Observe records the value within the series of the given label values.
+func (h *Histogram) Observe(value float64, labels ...string) {
+	key := h.key(labels)
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	series, ok := h.series[key]
+
+	if !ok {
+		series = &histogramSeries{labels: append([]string{}, labels...), counts: make([]uint64, len(h.buckets))}
+		h.series[key] = series
+	}
+
+	for i, bound := range h.buckets {
+		if value <= bound {
+			series.counts[i]++
+			break
+		}
+	}
+
+	series.sum += value
+	series.count++
+}
+
+// Count returns the number of values observed by the series of the given label values.
+func (h *Histogram) Count(labels ...string) uint64 {
+	key := h.key(labels)
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if series, ok := h.series[key]; ok {
+		return series.count
+	}
+
+	return 0
+}
+
+func (h *Histogram) write(buffer *bytes.Buffer) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.writeHeader(buffer, "histogram")
+	keys := make([]string, 0, len(h.series))
+
+	for key := range h.series {
+		keys = append(keys, key)
+	}
+
+	for _, key := range sortedKeys(keys) {
+		series := h.series[key]
+		var cumulative uint64
+
+		for i, bound := range h.buckets {
+			cumulative += series.counts[i]
+			fmt.Fprintf(buffer, "%v_bucket%v %v\n", h.name, h.formatLabels(series.labels, "le", formatFloat(bound)), cumulative)
+		}
+
+		fmt.Fprintf(buffer, "%v_bucket%v %v\n", h.name, h.formatLabels(series.labels, "le", "+Inf"), series.count)
+		fmt.Fprintf(buffer, "%v_sum%v %v\n", h.name, h.formatLabels(series.labels), formatFloat(series.sum))
+		fmt.Fprintf(buffer, "%v_count%v %v\n", h.name, h.formatLabels(series.labels), series.count)
+	}
+}
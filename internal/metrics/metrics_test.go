@@ -0,0 +1,78 @@
+package metrics
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRegistry ensures counters and histograms are written in the prometheus text
+// exposition format, in the order they were registered with sorted series.
+func TestRegistry(t *testing.T) {
+	registry := NewRegistry()
+
+	retries := registry.Counter("mavic_retries_total", "The requests retried.")
+	images := registry.Counter("mavic_images_total", "The images processed by state.", "state")
+	latency := registry.Histogram("mavic_request_duration_seconds", "The request latency.", []float64{0.1, 1}, "host")
+
+	images.Add(0, "SKIPPED")
+	images.Inc("SUCCESS")
+	images.Add(2, "SUCCESS")
+	images.Add(-1, "SUCCESS")
+
+	latency.Observe(0.05, `i.redd.it`)
+	latency.Observe(0.5, `i.redd.it`)
+	latency.Observe(3, `i.redd.it`)
+
+	assert.Equal(t, float64(3), images.Value("SUCCESS"))
+	assert.Equal(t, uint64(3), latency.Count("i.redd.it"))
+	assert.Panics(t, func() { images.Inc() })
+
+	var buffer bytes.Buffer
+	_, err := registry.WriteTo(&buffer)
+	require.NoError(t, err)
+
+	assert.Equal(t, `# HELP mavic_retries_total The requests retried.
+# TYPE mavic_retries_total counter
+mavic_retries_total 0
+# HELP mavic_images_total The images processed by state.
+# TYPE mavic_images_total counter
+mavic_images_total{state="SKIPPED"} 0
+mavic_images_total{state="SUCCESS"} 3
+# HELP mavic_request_duration_seconds The request latency.
+# TYPE mavic_request_duration_seconds histogram
+mavic_request_duration_seconds_bucket{host="i.redd.it",le="0.1"} 1
+mavic_request_duration_seconds_bucket{host="i.redd.it",le="1"} 2
+mavic_request_duration_seconds_bucket{host="i.redd.it",le="+Inf"} 3
+mavic_request_duration_seconds_sum{host="i.redd.it"} 3.55
+mavic_request_duration_seconds_count{host="i.redd.it"} 3
+`, buffer.String())
+
+	retries.Inc()
+	assert.Contains(t, scrape(t, registry), "mavic_retries_total 1\n")
+}
+
+// TestEscapeLabel ensures label values that contain quotes, backslashes or new
+// lines are escaped.
+func TestEscapeLabel(t *testing.T) {
+	registry := NewRegistry()
+	registry.Counter("test_total", "Test.", "name").Inc("a \"b\" \\ c\n")
+
+	assert.Contains(t, scrape(t, registry), `test_total{name="a \"b\" \\ c\n"} 1`)
+}
+
+// scrape requests the metrics of the registry over http, the same as prometheus.
+func scrape(t *testing.T, registry *Registry) string {
+	recorder := httptest.NewRecorder()
+	registry.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+
+	assert.Equal(t, contentType, recorder.Header().Get("Content-Type"))
+
+	body, err := ioutil.ReadAll(recorder.Body)
+	require.NoError(t, err)
+	return string(body)
+}
@@ -27,6 +27,7 @@ type ListingData struct {
 }
 
 type Child struct {
+	Kind *string    `json:"kind,omitempty"`
 	Data *ChildData `json:"data,omitempty"`
 }
 
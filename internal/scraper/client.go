@@ -0,0 +1,190 @@
+package scraper
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// DefaultUserAgent is the user agent sent with every request when no custom
+// user agent is given, identifying the application as reddit asks clients to.
+const DefaultUserAgent = "mavic (+https://github.com/stephensli/mavic)"
+
+// NewHTTPClient creates the http client shared by every request the scraper makes,
+// configured from the connection options. When the options already contain a
+// client, a copy of it is used as the base over building a new transport. The
+// user agent and extra headers are set on every request sent by the client.
+func NewHTTPClient(options Options) (*http.Client, error) {
+	headers, err := parseHeaders(options.Headers)
+
+	if err != nil {
+		return nil, err
+	}
+
+	userAgent := options.UserAgent
+
+	if userAgent == "" {
+		userAgent = DefaultUserAgent
+	}
+
+	var client http.Client
+
+	if options.HTTPClient != nil {
+		client = *options.HTTPClient
+	} else {
+		transport, err := newTransport(options)
+
+		if err != nil {
+			return nil, err
+		}
+
+		client.Transport = transport
+	}
+
+	client.Transport = &headerTransport{base: client.Transport, userAgent: userAgent, headers: headers}
+	return &client, nil
+}
+
+// newTransport creates the transport with the proxy, timeouts and certificate
+// authorities from the given options, based on the default transport.
+func newTransport(options Options) (*http.Transport, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if options.Proxy != "" {
+		proxyUrl, err := url.Parse(options.Proxy)
+
+		if err != nil || proxyUrl.Host == "" {
+			return nil, fmt.Errorf("%w: '%v'", ErrInvalidProxy, options.Proxy)
+		}
+
+		switch proxyUrl.Scheme {
+		case "http", "https", "socks5":
+		default:
+			return nil, fmt.Errorf("%w: unsupported scheme '%v', expected http, https or socks5",
+				ErrInvalidProxy, proxyUrl.Scheme)
+		}
+
+		transport.Proxy = http.ProxyURL(proxyUrl)
+	}
+
+	dialer := &net.Dialer{Timeout: options.ConnectTimeout, KeepAlive: 30 * time.Second}
+	readTimeout := options.ReadTimeout
+
+	transport.DialContext = func(ctx context.Context, network, address string) (net.Conn, error) {
+		conn, err := dialer.DialContext(ctx, network, address)
+
+		if err != nil || readTimeout <= 0 {
+			return conn, err
+		}
+
+		return &deadlineConn{Conn: conn, timeout: readTimeout}, nil
+	}
+
+	if options.ConnectTimeout > 0 {
+		transport.TLSHandshakeTimeout = options.ConnectTimeout
+	}
+
+	if options.ReadTimeout > 0 {
+		transport.ResponseHeaderTimeout = options.ReadTimeout
+	}
+
+	if options.CABundle != "" {
+		pool, err := loadCABundle(options.CABundle)
+
+		if err != nil {
+			return nil, err
+		}
+
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+
+	return transport, nil
+}
+
+// loadCABundle loads the pem encoded certificates at the given path on top of the
+// system certificate pool.
+func loadCABundle(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCABundle, err)
+	}
+
+	pool, err := x509.SystemCertPool()
+
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("%w: no certificates found in '%v'", ErrInvalidCABundle, path)
+	}
+
+	return pool, nil
+}
+
+// parseHeaders parses the extra headers given in the "Name: value" form.
+func parseHeaders(values []string) (http.Header, error) {
+	headers := http.Header{}
+
+	for _, value := range values {
+		parts := strings.SplitN(value, ":", 2)
+
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			return nil, fmt.Errorf("%w: '%v', expected 'Name: value'", ErrInvalidHeader, value)
+		}
+
+		headers.Add(strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]))
+	}
+
+	return headers, nil
+}
+
+// headerTransport sets the user agent and extra headers on every request before
+// passing it onto the base transport.
+type headerTransport struct {
+	base      http.RoundTripper
+	userAgent string
+	headers   http.Header
+}
+
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.base
+
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	// a round tripper must not modify the given request.
+	req = req.Clone(req.Context())
+	req.Header.Set("User-Agent", t.userAgent)
+
+	for name, values := range t.headers {
+		req.Header[name] = values
+	}
+
+	return base.RoundTrip(req)
+}
+
+// deadlineConn extends the read deadline of the connection before every read,
+// failing a transfer that stalls for longer than the timeout without limiting
+// how long a large download can take overall.
+type deadlineConn struct {
+	net.Conn
+	timeout time.Duration
+}
+
+func (c *deadlineConn) Read(b []byte) (int, error) {
+	if err := c.Conn.SetReadDeadline(time.Now().Add(c.timeout)); err != nil {
+		return 0, err
+	}
+
+	return c.Conn.Read(b)
+}
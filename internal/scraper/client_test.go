@@ -0,0 +1,144 @@
+package scraper
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestNewHTTPClientHeaders ensures the user agent and extra headers are sent with
+// every request, including when a client is injected.
+func TestNewHTTPClientHeaders(t *testing.T) {
+	var received http.Header
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header
+	}))
+
+	defer server.Close()
+
+	client, err := NewHTTPClient(Options{Headers: []string{"X-Trace: abc", "Accept-Language:en"}})
+	require.NoError(t, err)
+
+	_, err = client.Get(server.URL)
+	require.NoError(t, err)
+
+	assert.Equal(t, DefaultUserAgent, received.Get("User-Agent"))
+	assert.Equal(t, "abc", received.Get("X-Trace"))
+	assert.Equal(t, "en", received.Get("Accept-Language"))
+
+	injected := &http.Client{}
+	client, err = NewHTTPClient(Options{UserAgent: "custom/1.0", HTTPClient: injected})
+	require.NoError(t, err)
+
+	_, err = client.Get(server.URL)
+	require.NoError(t, err)
+
+	assert.Equal(t, "custom/1.0", received.Get("User-Agent"))
+	assert.Nil(t, injected.Transport, "the injected client must not be modified")
+}
+
+// TestNewHTTPClientProxy ensures requests are sent through the configured proxy.
+func TestNewHTTPClientProxy(t *testing.T) {
+	var proxied string
+
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r.URL.String()
+	}))
+
+	defer proxy.Close()
+
+	client, err := NewHTTPClient(Options{Proxy: proxy.URL})
+	require.NoError(t, err)
+
+	_, err = client.Get("http://www.reddit.com/r/cute/hot.json")
+	require.NoError(t, err)
+	assert.Equal(t, "http://www.reddit.com/r/cute/hot.json", proxied)
+}
+
+// TestNewHTTPClientCABundle ensures a server signed by a certificate authority
+// within the bundle is trusted, while it is not trusted without the bundle.
+func TestNewHTTPClientCABundle(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	bundle := filepath.Join(t.TempDir(), "ca.pem")
+	certificate := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	require.NoError(t, os.WriteFile(bundle, certificate, 0644))
+
+	client, err := NewHTTPClient(Options{})
+	require.NoError(t, err)
+
+	_, err = client.Get(server.URL)
+	assert.Error(t, err)
+
+	client, err = NewHTTPClient(Options{CABundle: bundle})
+	require.NoError(t, err)
+
+	_, err = client.Get(server.URL)
+	assert.NoError(t, err)
+}
+
+// TestNewHTTPClientReadTimeout ensures a response that stops sending data fails
+// once the read timeout is reached.
+func TestNewHTTPClientReadTimeout(t *testing.T) {
+	release := make(chan struct{})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "1024")
+		_, _ = w.Write([]byte("partial"))
+		w.(http.Flusher).Flush()
+		<-release
+	}))
+
+	defer server.Close()
+	defer close(release)
+
+	client, err := NewHTTPClient(Options{ReadTimeout: 50 * time.Millisecond})
+	require.NoError(t, err)
+
+	resp, err := client.Get(server.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	buffer := make([]byte, 1024)
+	_, err = resp.Body.Read(buffer)
+	require.NoError(t, err)
+
+	_, err = resp.Body.Read(buffer)
+	assert.True(t, isRetryable(err), "a stalled response should be retryable: %v", err)
+}
+
+// TestNewHTTPClientInvalidOptions ensures invalid connection options are returned
+// as the matching error.
+func TestNewHTTPClientInvalidOptions(t *testing.T) {
+	emptyBundle := filepath.Join(t.TempDir(), "empty.pem")
+	require.NoError(t, os.WriteFile(emptyBundle, []byte("not a certificate"), 0644))
+
+	tests := []struct {
+		options  Options
+		expected error
+	}{
+		{Options{Proxy: "ftp://host:21"}, ErrInvalidProxy},
+		{Options{Proxy: "://"}, ErrInvalidProxy},
+		{Options{Headers: []string{"missing separator"}}, ErrInvalidHeader},
+		{Options{Headers: []string{": value"}}, ErrInvalidHeader},
+		{Options{CABundle: filepath.Join(t.TempDir(), "missing.pem")}, ErrInvalidCABundle},
+		{Options{CABundle: emptyBundle}, ErrInvalidCABundle},
+	}
+
+	for _, test := range tests {
+		_, err := NewHTTPClient(test.options)
+		assert.ErrorIs(t, err, test.expected)
+	}
+
+	_, err := NewHTTPClient(Options{Proxy: "socks5://127.0.0.1:1080"})
+	assert.NoError(t, err)
+}
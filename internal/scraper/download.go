@@ -0,0 +1,370 @@
+package scraper
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	// partialExtension is appended to the image path while the image is being
+	// downloaded, the file is only renamed into place once fully downloaded and
+	// validated, so a image path existing always means a complete download.
+	partialExtension = ".part"
+	// partialStateExtension is appended to the partial path for the file holding
+	// the validators required to safely resume the partial download.
+	partialStateExtension = ".json"
+)
+
+var (
+	// errEmptyResponse is returned when the server responded successfully but did
+	// not send any content, which would otherwise be saved as a zero byte image.
+	errEmptyResponse = errors.New("empty response body")
+	// errNotMedia is returned when the server responded with something other than
+	// a image or video, e.g a html error page.
+	errNotMedia = errors.New("response is not a image or video")
+	// errRemoved is returned when the host responded with its placeholder for a
+	// image that has been removed, over the image itself.
+	errRemoved = errors.New("image has been removed by the host")
+)
+
+// removedPlaceholders are the locations hosts redirect to when a image has been
+// removed, the placeholder is a valid image so must be detected by location.
+var removedPlaceholders = []struct {
+	host string
+	path string
+}{
+	{host: "i.imgur.com", path: "/removed.png"},
+	{host: "imgur.com", path: "/removed.png"},
+}
+
+// isRemovedPlaceholder returns true if the given url is a known placeholder for
+// a removed image.
+func isRemovedPlaceholder(u *url.URL) bool {
+	for _, placeholder := range removedPlaceholders {
+		if strings.EqualFold(u.Host, placeholder.host) && u.Path == placeholder.path {
+			return true
+		}
+	}
+
+	return false
+}
+
+// validateMediaType ensures the declared content type is not something other
+// than media, a missing or generic binary content type is left to the sniffing
+// of the body.
+func validateMediaType(contentType string) error {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+
+	switch {
+	case mediaType == "", mediaType == "application/octet-stream", mediaType == "binary/octet-stream":
+		return nil
+	case strings.HasPrefix(mediaType, "image/"), strings.HasPrefix(mediaType, "video/"):
+		return nil
+	}
+
+	return fmt.Errorf("%w: content type %v", errNotMedia, mediaType)
+}
+
+// isMediaContent sniffs the leading bytes of the body to ensure it is really a
+// image or video, mp4 files are checked directly since only some brands are
+// recognised by the standard library.
+func isMediaContent(header []byte) bool {
+	if len(header) >= 8 && string(header[4:8]) == "ftyp" {
+		return true
+	}
+
+	contentType := http.DetectContentType(header)
+	return strings.HasPrefix(contentType, "image/") || strings.HasPrefix(contentType, "video/")
+}
+
+// partialState is persisted next to a partial download as soon as the response
+// arrives, containing what is needed to resume it on the next run even when the
+// process is killed part way through the download.
+type partialState struct {
+	// The link the partial download was downloaded from.
+	Link string `json:"link"`
+	// The strong entity tag of the image, used as the If-Range validator.
+	ETag string `json:"etag,omitempty"`
+	// The last modified date of the image, used as the If-Range validator when no
+	// strong entity tag was given by the server.
+	LastModified string `json:"lastModified,omitempty"`
+}
+
+// validator returns the value for the If-Range header, empty if the partial
+// download cannot be safely resumed.
+func (p partialState) validator() string {
+	if p.ETag != "" && !strings.HasPrefix(p.ETag, "W/") {
+		return p.ETag
+	}
+
+	return p.LastModified
+}
+
+// newPartialState creates the resume state of the download from the response, ok
+// is false when the server gave no validator or does not support ranges, in which
+// case the download cannot be safely resumed.
+func newPartialState(link string, resp *http.Response) (partialState, bool) {
+	state := partialState{
+		Link:         link,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+	}
+
+	return state, state.validator() != "" && resp.Header.Get("Accept-Ranges") != "none"
+}
+
+func writePartialState(partPath string, state partialState) error {
+	data, err := json.Marshal(state)
+
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(partPath+partialStateExtension, data, 0644)
+}
+
+func readPartialState(partPath string) (partialState, bool) {
+	data, err := os.ReadFile(partPath + partialStateExtension)
+
+	if err != nil {
+		return partialState{}, false
+	}
+
+	var state partialState
+
+	if err := json.Unmarshal(data, &state); err != nil {
+		return partialState{}, false
+	}
+
+	return state, true
+}
+
+// removePartial removes the partial download and its resume state.
+func removePartial(partPath string) {
+	_ = os.Remove(partPath)
+	_ = os.Remove(partPath + partialStateExtension)
+}
+
+// resumeOffset returns the number of bytes already downloaded for a partial
+// download of the same link which can be resumed and its If-Range validator,
+// partial downloads that cannot be resumed are removed.
+func resumeOffset(partPath string, link string) (int64, string) {
+	info, err := os.Stat(partPath)
+
+	if err != nil {
+		return 0, ""
+	}
+
+	state, ok := readPartialState(partPath)
+
+	if !ok || state.Link != link || state.validator() == "" || info.Size() == 0 {
+		removePartial(partPath)
+		return 0, ""
+	}
+
+	return info.Size(), state.validator()
+}
+
+// contentRangeStart parses the start and total length from a Content-Range
+// header, e.g "bytes 100-199/200". The total is -1 when unknown.
+func contentRangeStart(header string) (int64, int64, error) {
+	var start, end int64
+	var total string
+
+	if _, err := fmt.Sscanf(header, "bytes %d-%d/%s", &start, &end, &total); err != nil {
+		return 0, 0, fmt.Errorf("invalid content range '%v'", header)
+	}
+
+	if total == "*" {
+		return start, -1, nil
+	}
+
+	length, err := strconv.ParseInt(total, 10, 64)
+	return start, length, err
+}
+
+// downloadToFile downloads the given link into a partial file next to the given
+// path, validating the response before syncing and renaming it into place. When
+// a previous run left a resumable partial download, only the remaining bytes are
+// requested with a range request, falling back to a full download if the server
+// does not support ranges or the image has changed. A failed download that can
+// be resumed is kept for the next run, otherwise it is removed so no junk is left
+// behind. The number of bytes transferred is returned even on failure.
+func downloadToFile(ctx context.Context, client *http.Client, imagePath string, link string) (int64, error) {
+	partPath := imagePath + partialExtension
+	offset, validator := resumeOffset(partPath, link)
+
+	req, err := http.NewRequestWithContext(ctx, "GET", link, nil)
+
+	if err != nil {
+		return 0, err
+	}
+
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		req.Header.Set("If-Range", validator)
+	}
+
+	resp, httpErr := client.Do(req)
+
+	// early return if we failed to download the given file due to a
+	// unexpected http error.
+	if httpErr != nil {
+		return 0, httpErr
+	}
+
+	defer resp.Body.Close()
+
+	// the partial download is already complete or the image shrunk, either way
+	// the partial cannot be trusted and the image is downloaded again in full.
+	if resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0 {
+		removePartial(partPath)
+		return downloadToFile(ctx, client, imagePath, link)
+	}
+
+	if resp.Request != nil && isRemovedPlaceholder(resp.Request.URL) {
+		return 0, errRemoved
+	}
+
+	expectedLength := resp.ContentLength
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	body := bufio.NewReader(resp.Body)
+
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && offset > 0:
+		start, total, err := contentRangeStart(resp.Header.Get("Content-Range"))
+
+		if err != nil {
+			return 0, err
+		}
+
+		if start != offset {
+			removePartial(partPath)
+			return 0, fmt.Errorf("server resumed from byte %v but %v was requested", start, offset)
+		}
+
+		flags = os.O_WRONLY | os.O_APPEND
+		expectedLength = total
+	case resp.StatusCode >= 200 && resp.StatusCode <= 299:
+		// the server ignored the range (or the validator no longer matched) and
+		// sent the entire image, so the partial is overwritten from the start.
+		offset = 0
+	default:
+		return 0, newStatusError(resp)
+	}
+
+	if err := validateMediaType(resp.Header.Get("Content-Type")); err != nil {
+		return 0, err
+	}
+
+	// the leading bytes are only available to sniff when the body starts at the
+	// beginning of the image, resumed downloads were sniffed when first started.
+	if offset == 0 {
+		header, _ := body.Peek(512)
+
+		if len(header) > 0 && !isMediaContent(header) {
+			return 0, errNotMedia
+		}
+	}
+
+	out, createErr := os.OpenFile(partPath, flags, 0644)
+
+	// early return if the os failed to create any of the folders, since there is
+	// no reason to attempt to download the file if we don't have any where to
+	// write the file to after wards.
+	if createErr != nil {
+		return 0, createErr
+	}
+
+	// the resume state is written before the body, so a partial download left
+	// behind by a run that was killed part way through can still be resumed.
+	state, resumable := newPartialState(link, resp)
+
+	if resumable {
+		resumable = writePartialState(partPath, state) == nil
+	}
+
+	if !resumable {
+		_ = os.Remove(partPath + partialStateExtension)
+	}
+
+	written, err := io.Copy(out, body)
+
+	if err == nil && offset+written == 0 {
+		err = errEmptyResponse
+	}
+
+	// a expected length of -1 means the length is unknown (e.g chunked encoding),
+	// otherwise a mismatch means the connection was cut short.
+	if err == nil && expectedLength >= 0 && offset+written != expectedLength {
+		err = fmt.Errorf("expected %v bytes but received %v: %w", expectedLength, offset+written, errTruncated)
+	}
+
+	if err == nil {
+		err = out.Sync()
+	}
+
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err == nil {
+		err = os.Rename(partPath, imagePath)
+	}
+
+	// a failed download is kept along with its resume state to be resumed on
+	// the next run, unless it cannot be resumed or nothing was downloaded.
+	if err != nil {
+		if !resumable || offset+written == 0 {
+			removePartial(partPath)
+		}
+
+		return written, err
+	}
+
+	_ = os.Remove(partPath + partialStateExtension)
+	return written, nil
+}
+
+// removeStalePartials removes any partial downloads left within the given
+// directory that cannot be resumed, e.g a download from a server that gave no
+// validator by a previous run that was killed part way through.
+func removeStalePartials(dir string) {
+	entries, err := os.ReadDir(dir)
+
+	if err != nil {
+		return
+	}
+
+	for _, entry := range entries {
+		name := filepath.Join(dir, entry.Name())
+
+		if entry.IsDir() {
+			continue
+		}
+
+		if strings.HasSuffix(name, partialExtension) {
+			if state, ok := readPartialState(name); !ok || state.validator() == "" {
+				removePartial(name)
+			}
+		}
+
+		// resume state without the partial download it belongs to.
+		if strings.HasSuffix(name, partialExtension+partialStateExtension) {
+			if _, err := os.Stat(strings.TrimSuffix(name, partialStateExtension)); os.IsNotExist(err) {
+				_ = os.Remove(name)
+			}
+		}
+	}
+}
@@ -0,0 +1,310 @@
+package scraper
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sampleJPEG is the content of the image served by the test servers, starting with
+// the jpeg magic bytes so it passes the media sniffing.
+var sampleJPEG = []byte("\xFF\xD8\xFF\xE0image content")
+
+// newImageServer creates a test server serving a valid image on /image.jpg and
+// the different failure cases on the remaining paths.
+func newImageServer() *httptest.Server {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/image.jpg", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(sampleJPEG)
+	})
+
+	mux.HandleFunc("/missing.jpg", func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	})
+
+	mux.HandleFunc("/empty.jpg", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	mux.HandleFunc("/truncated.jpg", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "100")
+		_, _ = w.Write(sampleJPEG)
+	})
+
+	return httptest.NewServer(mux)
+}
+
+// TestDownloadToFile ensures a successful download is renamed into place and
+// that every failure case leaves nothing behind on disk.
+func TestDownloadToFile(t *testing.T) {
+	server := newImageServer()
+	defer server.Close()
+
+	dir := t.TempDir()
+	imagePath := filepath.Join(dir, "image.jpg")
+
+	written, err := downloadToFile(context.Background(), http.DefaultClient, imagePath, server.URL+"/image.jpg")
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(sampleJPEG)), written)
+	assert.FileExists(t, imagePath)
+	assert.NoFileExists(t, imagePath+partialExtension)
+
+	for _, link := range []string{"/missing.jpg", "/empty.jpg", "/truncated.jpg"} {
+		failedPath := filepath.Join(dir, "failed.jpg")
+
+		_, err := downloadToFile(context.Background(), http.DefaultClient, failedPath, server.URL+link)
+		assert.Error(t, err, link)
+		assert.NoFileExists(t, failedPath, link)
+		assert.NoFileExists(t, failedPath+partialExtension, link)
+	}
+}
+
+// resumableContent is the content of the video served by the resume servers.
+var resumableContent = append([]byte("\x00\x00\x00\x10ftypmp42\x00\x00\x00\x00"), bytes.Repeat([]byte("0123456789"), 999)...)
+
+// newResumeServer creates a test server serving the video on /video.mp4 with a
+// strong entity tag. When ranges are supported, range and if-range requests are
+// handled by the standard library, otherwise the full video is always sent.
+// Requests for /interrupted.mp4 send the headers of the full video but cut the
+// connection half way through the body.
+func newResumeServer(supportsRanges bool) (*httptest.Server, *[]string) {
+	var ranges []string
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/video.mp4", func(w http.ResponseWriter, r *http.Request) {
+		ranges = append(ranges, r.Header.Get("Range"))
+		w.Header().Set("ETag", `"video-etag"`)
+
+		if supportsRanges {
+			http.ServeContent(w, r, "video.mp4", time.Time{}, bytes.NewReader(resumableContent))
+			return
+		}
+
+		_, _ = w.Write(resumableContent)
+	})
+
+	mux.HandleFunc("/interrupted.mp4", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"video-etag"`)
+		w.Header().Set("Content-Length", strconv.Itoa(len(resumableContent)))
+		_, _ = w.Write(resumableContent[:len(resumableContent)/2])
+	})
+
+	return httptest.NewServer(mux), &ranges
+}
+
+// interruptDownload runs a download against the interrupted link, leaving a
+// resumable partial download of the first half of the video behind.
+func interruptDownload(t *testing.T, server *httptest.Server, imagePath string) {
+	_, err := downloadToFile(context.Background(), http.DefaultClient, imagePath, server.URL+"/interrupted.mp4")
+	require.Error(t, err)
+
+	partial, err := os.ReadFile(imagePath + partialExtension)
+	require.NoError(t, err)
+	assert.Equal(t, resumableContent[:len(resumableContent)/2], partial)
+
+	// the partial was downloaded from a different link, so rewrite the resume
+	// state as if it had come from the video link.
+	state, ok := readPartialState(imagePath + partialExtension)
+	require.True(t, ok)
+	state.Link = server.URL + "/video.mp4"
+	data, _ := json.Marshal(state)
+	require.NoError(t, os.WriteFile(imagePath+partialExtension+partialStateExtension, data, 0644))
+}
+
+// TestDownloadToFileResume ensures a interrupted download is resumed with a range
+// request, only transferring the remaining bytes.
+func TestDownloadToFileResume(t *testing.T) {
+	server, ranges := newResumeServer(true)
+	defer server.Close()
+
+	imagePath := filepath.Join(t.TempDir(), "video.mp4")
+	interruptDownload(t, server, imagePath)
+
+	written, err := downloadToFile(context.Background(), http.DefaultClient, imagePath, server.URL+"/video.mp4")
+	require.NoError(t, err)
+
+	assert.Equal(t, int64(len(resumableContent)/2), written)
+	assert.Equal(t, []string{fmt.Sprintf("bytes=%v-", len(resumableContent)/2)}, *ranges)
+
+	data, err := os.ReadFile(imagePath)
+	require.NoError(t, err)
+	assert.Equal(t, resumableContent, data)
+	assert.NoFileExists(t, imagePath+partialExtension)
+	assert.NoFileExists(t, imagePath+partialExtension+partialStateExtension)
+}
+
+// TestDownloadToFileResumeUnsupported ensures the full video is downloaded again
+// when the server ignores the range request.
+func TestDownloadToFileResumeUnsupported(t *testing.T) {
+	server, ranges := newResumeServer(false)
+	defer server.Close()
+
+	imagePath := filepath.Join(t.TempDir(), "video.mp4")
+	interruptDownload(t, server, imagePath)
+
+	written, err := downloadToFile(context.Background(), http.DefaultClient, imagePath, server.URL+"/video.mp4")
+	require.NoError(t, err)
+
+	assert.Equal(t, int64(len(resumableContent)), written)
+	assert.Equal(t, []string{fmt.Sprintf("bytes=%v-", len(resumableContent)/2)}, *ranges)
+
+	data, err := os.ReadFile(imagePath)
+	require.NoError(t, err)
+	assert.Equal(t, resumableContent, data)
+	assert.NoFileExists(t, imagePath+partialExtension)
+}
+
+// TestDownloadToFileResumeKilled ensures the resume state is written as soon as
+// the response arrives, so a partial download left behind by a run that was killed
+// part way through (without any error being handled) survives the clean up of the
+// next run and is resumed.
+func TestDownloadToFileResumeKilled(t *testing.T) {
+	server, ranges := newResumeServer(true)
+	defer server.Close()
+
+	halfway := make(chan struct{})
+	release := make(chan struct{})
+
+	server.Config.Handler.(*http.ServeMux).HandleFunc("/killed.mp4", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"video-etag"`)
+		w.Header().Set("Content-Length", strconv.Itoa(len(resumableContent)))
+		_, _ = w.Write(resumableContent[:len(resumableContent)/2])
+		w.(http.Flusher).Flush()
+
+		close(halfway)
+		<-release
+	})
+
+	dir := t.TempDir()
+	imagePath := filepath.Join(dir, "video.mp4")
+	partPath := imagePath + partialExtension
+
+	go func() {
+		_, _ = downloadToFile(context.Background(), http.DefaultClient, imagePath, server.URL+"/killed.mp4")
+	}()
+
+	<-halfway
+
+	// the state is on disk while the body is still being downloaded.
+	require.Eventually(t, func() bool {
+		_, ok := readPartialState(partPath)
+		return ok
+	}, 5*time.Second, 10*time.Millisecond)
+
+	state, _ := readPartialState(partPath)
+	assert.Equal(t, `"video-etag"`, state.validator())
+
+	// copy what a killed run would leave behind before the download finishes.
+	require.Eventually(t, func() bool {
+		info, err := os.Stat(partPath)
+		return err == nil && info.Size() == int64(len(resumableContent)/2)
+	}, 5*time.Second, 10*time.Millisecond)
+
+	killed := filepath.Join(t.TempDir(), "video.mp4")
+	partial, err := os.ReadFile(partPath)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(killed+partialExtension, partial, 0644))
+	state.Link = server.URL + "/video.mp4"
+	require.NoError(t, writePartialState(killed+partialExtension, state))
+	close(release)
+
+	removeStalePartials(filepath.Dir(killed))
+	assert.FileExists(t, killed+partialExtension)
+
+	written, err := downloadToFile(context.Background(), http.DefaultClient, killed, server.URL+"/video.mp4")
+	require.NoError(t, err)
+
+	assert.Equal(t, int64(len(resumableContent)/2), written)
+	assert.Equal(t, []string{fmt.Sprintf("bytes=%v-", len(resumableContent)/2)}, *ranges)
+
+	data, err := os.ReadFile(killed)
+	require.NoError(t, err)
+	assert.Equal(t, resumableContent, data)
+	assert.NoFileExists(t, killed+partialExtension+partialStateExtension)
+}
+
+// TestRemoveStalePartials ensures only partial downloads that cannot be resumed
+// are removed.
+func TestRemoveStalePartials(t *testing.T) {
+	dir := t.TempDir()
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.jpg"), []byte("a"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "b.jpg"+partialExtension), []byte("b"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "c.mp4"+partialExtension), []byte("c"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "c.mp4"+partialExtension+partialStateExtension),
+		[]byte(`{"link":"https://i.imgur.com/c.mp4","etag":"\"c\""}`), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "d.mp4"+partialExtension+partialStateExtension),
+		[]byte(`{"link":"https://i.imgur.com/d.mp4","etag":"\"d\""}`), 0644))
+
+	removeStalePartials(dir)
+
+	assert.FileExists(t, filepath.Join(dir, "a.jpg"))
+	assert.NoFileExists(t, filepath.Join(dir, "b.jpg"+partialExtension))
+	assert.FileExists(t, filepath.Join(dir, "c.mp4"+partialExtension))
+	assert.NoFileExists(t, filepath.Join(dir, "d.mp4"+partialExtension+partialStateExtension))
+}
+
+// TestDownloadToFileValidation ensures html error pages, mislabelled content and
+// host placeholders for removed images are never saved as images.
+func TestDownloadToFileValidation(t *testing.T) {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/removed.png", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("\x89PNG\r\n\x1a\nplaceholder"))
+	})
+
+	mux.HandleFunc("/gone.jpg", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/removed.png", http.StatusFound)
+	})
+
+	mux.HandleFunc("/page.jpg", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write([]byte("<html><body>not found</body></html>"))
+	})
+
+	mux.HandleFunc("/unlabelled.jpg", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		_, _ = w.Write([]byte("<html><body>not found</body></html>"))
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	serverURL, err := url.Parse(server.URL)
+	require.NoError(t, err)
+
+	removedPlaceholders = append(removedPlaceholders, struct {
+		host string
+		path string
+	}{host: serverURL.Host, path: "/removed.png"})
+
+	defer func() { removedPlaceholders = removedPlaceholders[:len(removedPlaceholders)-1] }()
+
+	dir := t.TempDir()
+
+	_, err = downloadToFile(context.Background(), http.DefaultClient, filepath.Join(dir, "gone.jpg"), server.URL+"/gone.jpg")
+	assert.ErrorIs(t, err, errRemoved)
+
+	_, err = downloadToFile(context.Background(), http.DefaultClient, filepath.Join(dir, "page.jpg"), server.URL+"/page.jpg")
+	assert.ErrorIs(t, err, errNotMedia)
+
+	_, err = downloadToFile(context.Background(), http.DefaultClient, filepath.Join(dir, "unlabelled.jpg"), server.URL+"/unlabelled.jpg")
+	assert.ErrorIs(t, err, errNotMedia)
+
+	files, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, files)
+}
@@ -0,0 +1,112 @@
+package scraper
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	// ErrInvalidPageType is returned when the page type is not one reddit supports.
+	ErrInvalidPageType = errors.New("invalid page type")
+	// ErrInvalidTarget is returned when a target is not in the "name:type:limit:folder" form.
+	ErrInvalidTarget = errors.New("invalid target")
+	// ErrInvalidReportPath is returned when the report path is not a supported format.
+	ErrInvalidReportPath = errors.New("invalid report path, the report must end in .json or .csv")
+	// ErrInvalidArchivePath is returned when the archive path is not a supported format.
+	ErrInvalidArchivePath = errors.New("invalid archive path, the archive must end in .zip, .tar or .tar.gz")
+	// ErrInvalidExportFormat is returned when the planned images are exported in a
+	// unsupported format.
+	ErrInvalidExportFormat = errors.New("invalid export format")
+	// ErrInvalidProxy is returned when the proxy is not a valid http, https or socks5 url.
+	ErrInvalidProxy = errors.New("invalid proxy")
+	// ErrInvalidHeader is returned when a extra header is not in the "Name: value" form.
+	ErrInvalidHeader = errors.New("invalid header")
+	// ErrInvalidCABundle is returned when the certificate authority bundle cannot be loaded.
+	ErrInvalidCABundle = errors.New("invalid ca bundle")
+	// ErrUserRequired is returned when the saved or upvoted posts are requested without
+	// being authenticated as a user.
+	ErrUserRequired = errors.New("saved and upvoted posts require a reddit username and password")
+	// ErrNoSubreddits is returned when there are no sub reddits to be scraped.
+	ErrNoSubreddits = errors.New("no subreddits provided")
+	// ErrWatchArchive is returned when watching is asked to write into a archive,
+	// which is only written once the run completes and watching never completes.
+	ErrWatchArchive = errors.New("watching cannot write into a archive")
+	// ErrSubredditNotFound is returned when the sub reddit does not exist.
+	ErrSubredditNotFound = errors.New("subreddit not found")
+	// ErrPrivateSubreddit is returned when the sub reddit is private.
+	ErrPrivateSubreddit = errors.New("subreddit is private")
+	// ErrBannedSubreddit is returned when the sub reddit has been banned.
+	ErrBannedSubreddit = errors.New("subreddit is banned")
+	// ErrQuarantinedSubreddit is returned when the sub reddit is quarantined,
+	// which requires a account that has opted in to view.
+	ErrQuarantinedSubreddit = errors.New("subreddit is quarantined")
+)
+
+// TargetError is a failure to scrape a single target (sub reddit or the front
+// page), the remaining targets are still scraped.
+type TargetError struct {
+	// The sub reddit (or front page) that failed.
+	Target string
+	// The reason the target failed.
+	Err error
+}
+
+func (e *TargetError) Error() string {
+	return fmt.Sprintf("r/%v: %v", e.Target, e.Err)
+}
+
+func (e *TargetError) Unwrap() error {
+	return e.Err
+}
+
+// State returns the machine readable state of the target, distinguishing a
+// sub reddit that is unavailable from a target that failed for any other reason.
+func (e *TargetError) State() string {
+	switch {
+	case errors.Is(e.Err, ErrSubredditNotFound):
+		return "NOT_FOUND"
+	case errors.Is(e.Err, ErrPrivateSubreddit):
+		return "PRIVATE"
+	case errors.Is(e.Err, ErrBannedSubreddit):
+		return "BANNED"
+	case errors.Is(e.Err, ErrQuarantinedSubreddit):
+		return "QUARANTINED"
+	}
+
+	return "FAILED"
+}
+
+// TargetErrors is returned from Start when one or more targets could not be
+// scraped, errors.Is and errors.As match against any of the target errors.
+type TargetErrors []*TargetError
+
+func (e TargetErrors) Error() string {
+	messages := make([]string, len(e))
+
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+
+	return strings.Join(messages, "; ")
+}
+
+func (e TargetErrors) Is(target error) bool {
+	for _, err := range e {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (e TargetErrors) As(target interface{}) bool {
+	for _, err := range e {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+
+	return false
+}
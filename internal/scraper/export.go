@@ -0,0 +1,94 @@
+package scraper
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+// The formats planned images can be exported in, allowing the links to be
+// downloaded by a external downloader into the same layout mavic would use.
+const (
+	// ExportText is the link and path of each image separated by a tab.
+	ExportText = "text"
+	// ExportJSON is a json line of each image.
+	ExportJSON = "json"
+	// ExportURLs is just the link of each image, one per line.
+	ExportURLs = "urls"
+	// ExportAria2 is a aria2 input file (aria2c -i), with the dir and out of each
+	// image so aria2 writes the image to the same path.
+	ExportAria2 = "aria2"
+	// ExportWget is a shell script of wget commands, since a wget input file
+	// (wget -i) cannot name the file of each link.
+	ExportWget = "wget"
+)
+
+// ExportFormats are all the supported export formats.
+var ExportFormats = []string{ExportText, ExportJSON, ExportURLs, ExportAria2, ExportWget}
+
+// Exporter writes the planned images in one of the export formats.
+type Exporter struct {
+	writer io.Writer
+	format string
+	// if anything has been written yet, used to write the header of formats
+	// that have one.
+	started bool
+}
+
+// NewExporter creates a exporter writing the planned images into the writer in
+// the given format, returning ErrInvalidExportFormat for a unsupported format.
+func NewExporter(writer io.Writer, format string) (*Exporter, error) {
+	for _, supported := range ExportFormats {
+		if format == supported {
+			return &Exporter{writer: writer, format: format}, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w '%v', expected one of %v", ErrInvalidExportFormat, format,
+		strings.Join(ExportFormats, ", "))
+}
+
+// Write writes the planned image. Images that already exist are only written in
+// the text and json formats, the external downloaders would otherwise download
+// the images mavic would skip.
+func (e *Exporter) Write(image PlannedImage) error {
+	var err error
+
+	switch e.format {
+	case ExportText:
+		_, err = fmt.Fprintf(e.writer, "%v\t%v\n", image.Link, image.Path)
+	case ExportJSON:
+		var line []byte
+
+		if line, err = json.Marshal(image); err == nil {
+			_, err = fmt.Fprintln(e.writer, string(line))
+		}
+	case ExportURLs:
+		if !image.Exists {
+			_, err = fmt.Fprintln(e.writer, image.Link)
+		}
+	case ExportAria2:
+		if !image.Exists {
+			_, err = fmt.Fprintf(e.writer, "%v\n  dir=%v\n  out=%v\n", image.Link, path.Dir(image.Path), path.Base(image.Path))
+		}
+	case ExportWget:
+		if !e.started {
+			_, err = fmt.Fprintln(e.writer, "#!/bin/sh")
+		}
+
+		if err == nil && !image.Exists {
+			_, err = fmt.Fprintf(e.writer, "mkdir -p %v && wget -O %v %v\n", shellQuote(path.Dir(image.Path)),
+				shellQuote(image.Path), shellQuote(image.Link))
+		}
+	}
+
+	e.started = true
+	return err
+}
+
+// shellQuote quotes the value as a single argument of a posix shell.
+func shellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
@@ -0,0 +1,50 @@
+package scraper
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var sampleImages = []PlannedImage{
+	{Subreddit: "cute", Id: "a", Link: "https://i.redd.it/a.jpg", Path: "pictures/cute/a.jpg"},
+	{Subreddit: "cute", Id: "b", Link: "https://i.redd.it/b.png", Path: "pictures/cute/b.png", Exists: true},
+	{Subreddit: "pics", Id: "c", Link: "https://i.imgur.com/c.mp4", Path: "pictures/it's/c.mp4"},
+}
+
+// TestExporter ensures each export format writes the images so the external
+// downloader produces the same layout, skipping the images that already exist.
+func TestExporter(t *testing.T) {
+	cases := map[string]string{
+		ExportText: "https://i.redd.it/a.jpg\tpictures/cute/a.jpg\n" +
+			"https://i.redd.it/b.png\tpictures/cute/b.png\n" +
+			"https://i.imgur.com/c.mp4\tpictures/it's/c.mp4\n",
+		ExportJSON: `{"subreddit":"cute","id":"a","link":"https://i.redd.it/a.jpg","path":"pictures/cute/a.jpg","exists":false}` + "\n" +
+			`{"subreddit":"cute","id":"b","link":"https://i.redd.it/b.png","path":"pictures/cute/b.png","exists":true}` + "\n" +
+			`{"subreddit":"pics","id":"c","link":"https://i.imgur.com/c.mp4","path":"pictures/it's/c.mp4","exists":false}` + "\n",
+		ExportURLs: "https://i.redd.it/a.jpg\nhttps://i.imgur.com/c.mp4\n",
+		ExportAria2: "https://i.redd.it/a.jpg\n  dir=pictures/cute\n  out=a.jpg\n" +
+			"https://i.imgur.com/c.mp4\n  dir=pictures/it's\n  out=c.mp4\n",
+		ExportWget: "#!/bin/sh\n" +
+			"mkdir -p 'pictures/cute' && wget -O 'pictures/cute/a.jpg' 'https://i.redd.it/a.jpg'\n" +
+			`mkdir -p 'pictures/it'\''s' && wget -O 'pictures/it'\''s/c.mp4' 'https://i.imgur.com/c.mp4'` + "\n",
+	}
+
+	for format, expected := range cases {
+		var output bytes.Buffer
+
+		exporter, err := NewExporter(&output, format)
+		require.NoError(t, err)
+
+		for _, image := range sampleImages {
+			require.NoError(t, exporter.Write(image))
+		}
+
+		assert.Equal(t, expected, output.String(), format)
+	}
+
+	_, err := NewExporter(&bytes.Buffer{}, "csv")
+	assert.ErrorIs(t, err, ErrInvalidExportFormat)
+}
@@ -0,0 +1,62 @@
+package scraper
+
+import (
+	"context"
+	"os"
+	"path"
+
+	"github.com/schollz/progressbar/v3"
+)
+
+// PlannedImage is a image that would be downloaded by a run, along with where
+// it would be written.
+type PlannedImage struct {
+	// The sub reddit the image was posted to.
+	Subreddit string `json:"subreddit"`
+	// The id of the post the image is from.
+	Id string `json:"id"`
+	// The link the image would be downloaded from.
+	Link string `json:"link"`
+	// The path the image would be written to, within the archive when writing
+	// into a archive.
+	Path string `json:"path"`
+	// If the image already exists within the output directory, in which case it
+	// would be skipped. Archives are not checked.
+	Exists bool `json:"exists"`
+}
+
+// List gathers the images of every target the same way as Start (taking the same
+// pages, limits and naming), calling onImage for each image in the order they
+// would be downloaded, without downloading any of the images or writing anything
+// to disk. Targets that fail are returned as TargetErrors once every other target
+// has been listed.
+func (s Scraper) List(ctx context.Context, onImage func(image PlannedImage)) error {
+	s.listOnly = true
+
+	var targetErrors TargetErrors
+	silent := progressbar.NewOptions(1, progressbar.OptionSetVisibility(false))
+
+	for queued := range s.downloadMetadata(ctx, silent, s.targets, &targetErrors) {
+		img := queued.image
+		planned := PlannedImage{Subreddit: img.Subreddit, Id: img.Id, Link: preferredLink(img.Link),
+			Path: path.Join(s.scrapingOptions.OutputDirectory, relativePath(queued))}
+
+		if s.scrapingOptions.ArchivePath != "" {
+			planned.Path = s.scrapingOptions.ArchivePath + ":" + relativePath(queued)
+		} else if _, err := os.Stat(planned.Path); !os.IsNotExist(err) {
+			planned.Exists = true
+		}
+
+		onImage(planned)
+	}
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	if len(targetErrors) > 0 {
+		return targetErrors
+	}
+
+	return nil
+}
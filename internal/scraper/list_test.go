@@ -0,0 +1,124 @@
+package scraper
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestList ensures the images are listed with where they would be written,
+// without anything being downloaded or written to disk.
+func TestList(t *testing.T) {
+	var downloads int
+
+	server := httptest.NewUnstartedServer(nil)
+	url := "http://" + server.Listener.Addr().String()
+
+	server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/r/cute/hot.json":
+			_, _ = fmt.Fprintf(w, `{"kind": "Listing", "data": {"children": [%v, %v]}}`,
+				watchPost(url, "a"), watchPost(url, "b"))
+		default:
+			downloads += 1
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	server.Start()
+	defer server.Close()
+
+	dir := filepath.Join(t.TempDir(), "output")
+	s, err := NewScraper(Options{PageType: "hot", ImageLimit: 10, OutputDirectory: dir, Subreddits: []string{"cute::10:animals"}})
+	require.NoError(t, err)
+	s.baseUrl = url
+
+	var planned []PlannedImage
+	require.NoError(t, s.List(context.Background(), func(image PlannedImage) { planned = append(planned, image) }))
+
+	assert.Equal(t, []PlannedImage{
+		{Subreddit: "cute", Id: "a", Link: url + "/images/a.jpg", Path: filepath.Join(dir, "animals", "a.jpg")},
+		{Subreddit: "cute", Id: "b", Link: url + "/images/b.jpg", Path: filepath.Join(dir, "animals", "b.jpg")},
+	}, planned)
+
+	assert.Zero(t, downloads)
+	_, err = os.Stat(dir)
+	assert.True(t, os.IsNotExist(err))
+
+	// images that already exist would be skipped.
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "animals"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "animals", "b.jpg"), sampleJPEG, 0644))
+
+	planned = nil
+	require.NoError(t, s.List(context.Background(), func(image PlannedImage) { planned = append(planned, image) }))
+	require.Len(t, planned, 2)
+	assert.False(t, planned[0].Exists)
+	assert.True(t, planned[1].Exists)
+}
+
+// TestListFrontPage ensures images from the front page keep the sub reddit they
+// were posted to, while being written into the front page folder.
+func TestListFrontPage(t *testing.T) {
+	server := httptest.NewUnstartedServer(nil)
+	url := "http://" + server.Listener.Addr().String()
+
+	server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, `{"kind": "Listing", "data": {"children": [%v]}}`, watchPost(url, "a"))
+	})
+
+	server.Start()
+	defer server.Close()
+
+	dir := t.TempDir()
+	s, err := NewScraper(Options{PageType: "hot", ImageLimit: 10, OutputDirectory: dir, FrontPage: true})
+	require.NoError(t, err)
+	s.baseUrl = url
+
+	var planned []PlannedImage
+	require.NoError(t, s.List(context.Background(), func(image PlannedImage) { planned = append(planned, image) }))
+
+	assert.Equal(t, []PlannedImage{
+		{Subreddit: "cute", Id: "a", Link: url + "/images/a.jpg", Path: filepath.Join(dir, "frontpage", "a.jpg")},
+	}, planned)
+}
+
+// TestListDuplicateTargets ensures the same sub reddit given more than once with
+// different folders has the images of each target written into its own folder.
+func TestListDuplicateTargets(t *testing.T) {
+	server := httptest.NewUnstartedServer(nil)
+	url := "http://" + server.Listener.Addr().String()
+
+	server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/r/cute/top.json":
+			_, _ = fmt.Fprintf(w, `{"kind": "Listing", "data": {"children": [%v]}}`, watchPost(url, "a"))
+		case "/r/cute/new.json":
+			_, _ = fmt.Fprintf(w, `{"kind": "Listing", "data": {"children": [%v]}}`, watchPost(url, "b"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	server.Start()
+	defer server.Close()
+
+	dir := t.TempDir()
+	s, err := NewScraper(Options{PageType: "hot", ImageLimit: 10, OutputDirectory: dir,
+		Subreddits: []string{"cute:top:10:best", "cute:new:10:latest"}})
+	require.NoError(t, err)
+	s.baseUrl = url
+
+	var paths []string
+	require.NoError(t, s.List(context.Background(), func(image PlannedImage) { paths = append(paths, image.Path) }))
+
+	assert.Equal(t, []string{filepath.Join(dir, "best", "a.jpg"), filepath.Join(dir, "latest", "b.jpg")}, paths)
+	assert.Equal(t, "cute:best", watchKey(s.targets[0]))
+	assert.Equal(t, "cute", watchKey(Target{Name: "cute"}))
+}
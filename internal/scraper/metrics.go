@@ -0,0 +1,120 @@
+package scraper
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/stephensli/mavic/internal/metrics"
+)
+
+// Metrics are the prometheus counters and histograms of the runs of a scraper,
+// used to monitor the throughput and failures of long running scrapes (e.g when
+// watching). A nil Metrics records nothing.
+type Metrics struct {
+	registry *metrics.Registry
+	// the listings fetched for each sub reddit.
+	listings *metrics.Counter
+	// the images processed by their final state.
+	images *metrics.Counter
+	// the bytes transferred by image downloads.
+	bytes *metrics.Counter
+	// how long each request took to respond, by host.
+	requestDuration *metrics.Histogram
+	// the listing and image requests retried after a transient failure.
+	retries *metrics.Counter
+	// the times reddit requests were held until the rate limit reset, along
+	// with how long was spent waiting.
+	rateLimitWaits       *metrics.Counter
+	rateLimitWaitSeconds *metrics.Counter
+}
+
+// NewMetrics creates the metrics, exposed through the Handler.
+func NewMetrics() *Metrics {
+	registry := metrics.NewRegistry()
+
+	m := &Metrics{
+		registry: registry,
+		listings: registry.Counter("mavic_listings_fetched_total",
+			"The reddit listings fetched by sub reddit.", "subreddit"),
+		images: registry.Counter("mavic_images_total",
+			"The images processed by state (SUCCESS, SKIPPED, REMOVED or FAILED).", "state"),
+		bytes: registry.Counter("mavic_downloaded_bytes_total",
+			"The bytes transferred downloading images."),
+		requestDuration: registry.Histogram("mavic_request_duration_seconds",
+			"How long requests took to respond with the headers by host.", metrics.DefaultBuckets, "host"),
+		retries: registry.Counter("mavic_retries_total",
+			"The listing and image requests retried after a transient failure."),
+		rateLimitWaits: registry.Counter("mavic_rate_limit_waits_total",
+			"The times reddit requests were held until the rate limit reset."),
+		rateLimitWaitSeconds: registry.Counter("mavic_rate_limit_wait_seconds_total",
+			"The seconds spent waiting for the reddit rate limit to reset."),
+	}
+
+	// every final state is exposed from the start, so rates can be taken before
+	// the first image of a state.
+	for _, state := range []DownloadState{SUCCESS, SKIPPED, REMOVED, FAILED} {
+		m.images.Add(0, state.String())
+	}
+
+	return m
+}
+
+// Handler returns the http handler serving the metrics in the prometheus text
+// exposition format.
+func (m *Metrics) Handler() http.Handler {
+	return m.registry
+}
+
+// observe records the final state of a image, the start of a download is not
+// counted.
+func (m *Metrics) observe(msg updateState) {
+	if m == nil || msg.state == DOWNLOADING {
+		return
+	}
+
+	m.images.Inc(msg.state.String())
+	m.bytes.Add(float64(msg.bytes))
+}
+
+// listingFetched records a listing fetched for the sub reddit.
+func (m *Metrics) listingFetched(subreddit string) {
+	if m != nil {
+		m.listings.Inc(subreddit)
+	}
+}
+
+// retried records a request being retried.
+func (m *Metrics) retried() {
+	if m != nil {
+		m.retries.Inc()
+	}
+}
+
+// rateLimited records requests being held for the given duration until the
+// rate limit resets.
+func (m *Metrics) rateLimited(wait time.Duration) {
+	if m != nil {
+		m.rateLimitWaits.Inc()
+		m.rateLimitWaitSeconds.Add(wait.Seconds())
+	}
+}
+
+// metricsTransport records how long each request took to respond, by host.
+type metricsTransport struct {
+	base    http.RoundTripper
+	metrics *Metrics
+}
+
+func (t *metricsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.base
+
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	start := time.Now()
+	resp, err := base.RoundTrip(req)
+	t.metrics.requestDuration.Observe(time.Since(start).Seconds(), req.URL.Hostname())
+
+	return resp, err
+}
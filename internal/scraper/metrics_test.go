@@ -0,0 +1,93 @@
+package scraper
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestMetrics ensures the listings fetched, image states, bytes downloaded,
+// request latencies and retries of a run are recorded and exposed.
+func TestMetrics(t *testing.T) {
+	var attempts int
+
+	server := httptest.NewUnstartedServer(nil)
+	serverUrl := "http://" + server.Listener.Addr().String()
+
+	server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/r/cute/hot.json":
+			_, _ = fmt.Fprintf(w, `{"kind": "Listing", "data": {"children": [%v, %v, %v]}}`,
+				watchPost(serverUrl, "a"), watchPost(serverUrl, "b"), watchPost(serverUrl, "c"))
+		case "/images/a.jpg":
+			// the first attempt fails with a transient error and is retried.
+			if attempts += 1; attempts == 1 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+
+			w.Header().Set("Content-Type", "image/jpeg")
+			_, _ = w.Write(sampleJPEG)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	server.Start()
+	defer server.Close()
+
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "cute"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "cute", "b.jpg"), sampleJPEG, 0644))
+
+	metrics := NewMetrics()
+	s, err := NewScraper(Options{PageType: "hot", ImageLimit: 10, OutputDirectory: dir, Subreddits: []string{"cute"},
+		RetryAttempts: 2, Metrics: metrics})
+	require.NoError(t, err)
+
+	s.baseUrl = serverUrl
+	s.retryPolicy.BaseDelay, s.retryPolicy.MaxDelay = 1, 1
+
+	require.NoError(t, s.Start(context.Background()))
+
+	host, _ := url.Parse(serverUrl)
+
+	assert.Equal(t, float64(1), metrics.listings.Value("cute"))
+	assert.Equal(t, float64(1), metrics.images.Value("SUCCESS"))
+	assert.Equal(t, float64(1), metrics.images.Value("SKIPPED"))
+	assert.Equal(t, float64(1), metrics.images.Value("FAILED"))
+	assert.Equal(t, float64(len(sampleJPEG)), metrics.bytes.Value())
+	assert.Equal(t, float64(1), metrics.retries.Value())
+	assert.Equal(t, uint64(4), metrics.requestDuration.Count(host.Hostname()))
+
+	recorder := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := ioutil.ReadAll(recorder.Body)
+
+	assert.Contains(t, string(body), `mavic_images_total{state="REMOVED"} 0`)
+	assert.Contains(t, string(body), `mavic_listings_fetched_total{subreddit="cute"} 1`)
+	assert.Contains(t, string(body), "mavic_rate_limit_waits_total 0")
+}
+
+// TestMetricsRateLimited ensures the rate limit waits are recorded.
+func TestMetricsRateLimited(t *testing.T) {
+	metrics := NewMetrics()
+	metrics.rateLimited(1500 * time.Millisecond)
+
+	assert.Equal(t, float64(1), metrics.rateLimitWaits.Value())
+	assert.Equal(t, 1.5, metrics.rateLimitWaitSeconds.Value())
+
+	// a nil metrics records nothing.
+	var disabled *Metrics
+	assert.NotPanics(t, func() { disabled.rateLimited(1); disabled.retried(); disabled.listingFetched("cute") })
+}
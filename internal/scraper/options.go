@@ -1,5 +1,13 @@
 package scraper
 
+import (
+	"net/http"
+	"time"
+
+	"github.com/stephensli/mavic/internal/auth"
+	"github.com/stephensli/mavic/internal/logging"
+)
+
 type Options struct {
 	//  The directory in which we will be downloading all the images into, based on the folder name
 	//  of the given sub-reddit.
@@ -9,6 +17,12 @@ type Options struct {
 	// If set to true, the tool will scrape the front page of reddit for the current most
 	// active sub-reddits and then scrape all the links directly from them sub-reddits.
 	FrontPage bool
+	// If set to true, the saved posts of the authenticated user are scraped into the saved folder,
+	// requiring the username and password of the user.
+	Saved bool
+	// If set to true, the upvoted posts of the authenticated user are scraped into the upvoted
+	// folder, requiring the username and password of the user.
+	Upvoted bool
 	// if the images are being downloaded directly into the root folder and nothing else.
 	RootFolderOnly bool
 	// You can change this to adjust on what kind of images you get from Reddits filtering
@@ -21,4 +35,52 @@ type Options struct {
 	// If the loading progress bar should be displayed or not. Simply used for headless progressing
 	// or testing that helps with minimising the amount of output that is generated to the console.
 	DisplayLoading bool
+	// If the title, author, sub reddit and permalink of the post should be written directly into
+	// the downloaded file (XMP/EXIF for jpeg, text chunks for png and metadata atoms for mp4).
+	EmbedMetadata bool
+	// If set, a report of every processed item (state, reason, bytes, duration and path) is written
+	// to this path at the end of the run. The format is determined by the extension, json or csv.
+	ReportPath string
+	// If greater than zero, a jpeg thumbnail scaled to fit within this many pixels is generated for
+	// every downloaded image into the hidden .thumbs folder of the output directory.
+	ThumbnailSize int
+	// If set, images are streamed into a archive at this path (zip, tar or tar.gz) instead of the
+	// output directory, using the same layout. Entries within a existing archive are skipped.
+	ArchivePath string
+	// The max number of attempts made for a listing or image request that fails with a transient
+	// error (timeouts, rate limiting or server errors), including the first attempt.
+	RetryAttempts int
+	// The delay before the first retry of a failed request, doubling (with jitter) on each attempt
+	// after unless the server specifies how long to wait with Retry-After.
+	RetryDelay time.Duration
+	// How long to wait for a connection (and tls handshake) to be established before failing the
+	// request, zero waits for as long as the operating system allows.
+	ConnectTimeout time.Duration
+	// How long a response can go without receiving any data (headers or body) before failing the
+	// request, zero never times out. Large downloads are not limited as long as data keeps arriving.
+	ReadTimeout time.Duration
+	// If set, every request is sent through this proxy, e.g http://host:8080 or socks5://host:1080.
+	// Otherwise the proxy is taken from the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment.
+	Proxy string
+	// The user agent sent with every request, DefaultUserAgent when empty.
+	UserAgent string
+	// Extra headers sent with every request in the "Name: value" form.
+	Headers []string
+	// If set, the pem encoded certificate authorities at this path are trusted in addition to
+	// the system certificate authorities, e.g for a intercepting proxy.
+	CABundle string
+	// If set, the client used for every request over building one from the connection options.
+	// The user agent and extra headers are still sent with every request.
+	HTTPClient *http.Client
+	// If set, reddit is accessed through the oauth api using these credentials, using the password
+	// grant when a username and password are given and the client credentials grant otherwise.
+	Credentials auth.Credentials
+	// The endpoint access tokens are requested from, auth.DefaultTokenURL when empty.
+	TokenURL string
+	// The logger every download state transition, failed sub reddit and rate limit wait is
+	// written to, nothing is logged when nil.
+	Logger *logging.Logger
+	// The metrics the listings fetched, image states, bytes downloaded, request latencies, retries
+	// and rate limit waits are recorded into, nothing is recorded when nil.
+	Metrics *Metrics
 }
@@ -0,0 +1,112 @@
+package scraper
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RateLimiter paces the requests made to reddit based on the rate limit headers
+// reddit sends with every response. The remaining requests are spread evenly over
+// the time left until the rate limit window resets, and once no requests remain
+// all requests wait for the window to reset. A single limiter is shared by all
+// reddit requests of a scraper.
+type RateLimiter struct {
+	mutex sync.Mutex
+	// if the rate limit is known, false until the first response with the rate
+	// limit headers or after the window has reset.
+	known bool
+	// the number of requests remaining within the current window.
+	remaining float64
+	// when the current rate limit window resets.
+	reset time.Time
+	// when the last request was allowed through, used for pacing.
+	last time.Time
+	// onThrottle is called before waiting for the window to reset, allowing a
+	// clear message to be shown to the user over silently stalling.
+	onThrottle func(wait time.Duration)
+
+	// the clock and sleep used by the limiter, replaced in tests.
+	now   func() time.Time
+	sleep func(context.Context, time.Duration) error
+}
+
+// NewRateLimiter creates a rate limiter, calling onThrottle (if not nil) each
+// time requests are held until the rate limit window resets.
+func NewRateLimiter(onThrottle func(wait time.Duration)) *RateLimiter {
+	return &RateLimiter{onThrottle: onThrottle, now: time.Now, sleep: sleepContext}
+}
+
+// Wait blocks until the next request is allowed to be made, returning the
+// context error if the context is cancelled while waiting.
+func (r *RateLimiter) Wait(ctx context.Context) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	now := r.now()
+
+	if !r.known || !now.Before(r.reset) {
+		r.known = false
+		r.last = now
+		return nil
+	}
+
+	untilReset := r.reset.Sub(now)
+
+	if r.remaining < 1 {
+		if r.onThrottle != nil {
+			r.onThrottle(untilReset)
+		}
+
+		if err := r.sleep(ctx, untilReset); err != nil {
+			return err
+		}
+
+		r.known = false
+		r.last = r.now()
+		return nil
+	}
+
+	// spread the remaining requests evenly across the remaining window.
+	next := r.last.Add(time.Duration(float64(untilReset) / r.remaining))
+
+	if wait := next.Sub(now); wait > 0 {
+		if err := r.sleep(ctx, wait); err != nil {
+			return err
+		}
+	}
+
+	r.remaining -= 1
+	r.last = r.now()
+	return nil
+}
+
+// Update updates the rate limit from the headers of a reddit response. A 429
+// response without the headers exhausts the window until the Retry-After.
+func (r *RateLimiter) Update(resp *http.Response) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	remaining, remainingErr := strconv.ParseFloat(resp.Header.Get("X-Ratelimit-Remaining"), 64)
+	reset, resetErr := strconv.ParseFloat(resp.Header.Get("X-Ratelimit-Reset"), 64)
+
+	if remainingErr == nil && resetErr == nil {
+		r.known = true
+		r.remaining = remaining
+		r.reset = r.now().Add(time.Duration(reset * float64(time.Second)))
+	}
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		wait := parseRetryAfter(resp.Header.Get("Retry-After"))
+
+		if resetErr == nil {
+			wait = time.Duration(reset * float64(time.Second))
+		}
+
+		r.known = true
+		r.remaining = 0
+		r.reset = r.now().Add(wait)
+	}
+}
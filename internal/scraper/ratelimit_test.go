@@ -0,0 +1,88 @@
+package scraper
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestRateLimiter creates a rate limiter using a fake clock that only moves
+// forward when the limiter sleeps, recording every sleep made.
+func newTestRateLimiter() (*RateLimiter, *[]time.Duration, *[]time.Duration) {
+	var slept, throttled []time.Duration
+	clock := time.Date(2021, 10, 1, 0, 0, 0, 0, time.UTC)
+
+	limiter := NewRateLimiter(func(wait time.Duration) { throttled = append(throttled, wait) })
+	limiter.now = func() time.Time { return clock }
+	limiter.sleep = func(_ context.Context, d time.Duration) error {
+		slept = append(slept, d)
+		clock = clock.Add(d)
+		return nil
+	}
+
+	return limiter, &slept, &throttled
+}
+
+func rateLimitResponse(status int, remaining, reset string) *http.Response {
+	header := http.Header{}
+	header.Set("X-Ratelimit-Remaining", remaining)
+	header.Set("X-Ratelimit-Reset", reset)
+	return &http.Response{StatusCode: status, Header: header}
+}
+
+// TestRateLimiterUnknown ensures requests are never held before reddit has sent
+// any rate limit headers.
+func TestRateLimiterUnknown(t *testing.T) {
+	limiter, slept, _ := newTestRateLimiter()
+
+	_ = limiter.Wait(context.Background())
+	limiter.Update(&http.Response{StatusCode: http.StatusOK, Header: http.Header{}})
+	_ = limiter.Wait(context.Background())
+
+	assert.Empty(t, *slept)
+}
+
+// TestRateLimiterPacing ensures the remaining requests are spread evenly over
+// the remaining rate limit window.
+func TestRateLimiterPacing(t *testing.T) {
+	limiter, slept, throttled := newTestRateLimiter()
+
+	_ = limiter.Wait(context.Background())
+	limiter.Update(rateLimitResponse(http.StatusOK, "10.0", "100"))
+	_ = limiter.Wait(context.Background())
+	_ = limiter.Wait(context.Background())
+
+	assert.Equal(t, []time.Duration{10 * time.Second, 10 * time.Second}, *slept)
+	assert.Empty(t, *throttled)
+}
+
+// TestRateLimiterExhausted ensures requests wait for the window to reset once
+// no requests remain, notifying that the requests are being throttled.
+func TestRateLimiterExhausted(t *testing.T) {
+	limiter, slept, throttled := newTestRateLimiter()
+
+	limiter.Update(rateLimitResponse(http.StatusOK, "0.0", "42"))
+	_ = limiter.Wait(context.Background())
+	_ = limiter.Wait(context.Background())
+
+	assert.Equal(t, []time.Duration{42 * time.Second}, *slept)
+	assert.Equal(t, []time.Duration{42 * time.Second}, *throttled)
+}
+
+// TestRateLimiterTooManyRequests ensures a 429 without rate limit headers holds
+// requests until the Retry-After.
+func TestRateLimiterTooManyRequests(t *testing.T) {
+	limiter, slept, throttled := newTestRateLimiter()
+
+	header := http.Header{}
+	header.Set("Retry-After", "7")
+
+	limiter.Update(&http.Response{StatusCode: http.StatusTooManyRequests, Header: header})
+	_ = limiter.Wait(context.Background())
+
+	assert.Equal(t, []time.Duration{7 * time.Second}, *slept)
+	assert.Len(t, *throttled, 1)
+}
@@ -0,0 +1,251 @@
+package scraper
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ReportEntry is a single processed item within a run report, containing the
+// final state of the item and how it got there.
+type ReportEntry struct {
+	// The id of the reddit post the image was linked from.
+	Id string `json:"id"`
+	// The image id, the ending part of the link.
+	ImageId string `json:"imageId"`
+	// The sub reddit (or front page) the image was scraped from.
+	Subreddit string `json:"subreddit"`
+	// The title of the reddit post.
+	Title string `json:"title"`
+	// The link to the source image that was downloaded.
+	Link string `json:"link"`
+	// The link to the reddit post.
+	PostLink string `json:"postLink"`
+	// The final state of the download, e.g SUCCESS, SKIPPED, FAILED, REMOVED.
+	State string `json:"state"`
+	// The reason the item was skipped or failed, empty on success.
+	Reason string `json:"reason,omitempty"`
+	// The number of bytes transferred during the download.
+	Bytes int64 `json:"bytes"`
+	// How long processing of the item took in milliseconds.
+	DurationMs int64 `json:"durationMs"`
+	// The destination path of the image on disk.
+	Path string `json:"path"`
+}
+
+// ReportTarget is a target (sub reddit or the front page) that could not be
+// scraped within a run report.
+type ReportTarget struct {
+	// The sub reddit (or front page) that could not be scraped.
+	Subreddit string `json:"subreddit"`
+	// The state of the target, e.g NOT_FOUND, PRIVATE, BANNED, QUARANTINED, FAILED.
+	State string `json:"state"`
+	// The reason the target could not be scraped.
+	Reason string `json:"reason"`
+}
+
+// Report is the machine readable outcome of a single run, every processed
+// item is recorded along with the summary counts and the targets that could
+// not be scraped.
+type Report struct {
+	Downloaded int            `json:"downloaded"`
+	Skipped    int            `json:"skipped"`
+	Failed     int            `json:"failed"`
+	Removed    int            `json:"removed"`
+	Items      []ReportEntry  `json:"items"`
+	Targets    []ReportTarget `json:"targets"`
+}
+
+// add records the final state of a processed item within the report.
+func (r *Report) add(msg updateState) {
+	switch msg.state {
+	case SUCCESS:
+		r.Downloaded += 1
+	case SKIPPED:
+		r.Skipped += 1
+	case FAILED:
+		r.Failed += 1
+	case REMOVED:
+		r.Removed += 1
+	}
+
+	r.Items = append(r.Items, ReportEntry{
+		Id:         msg.image.Id,
+		ImageId:    msg.image.ImageId,
+		Subreddit:  msg.image.Subreddit,
+		Title:      msg.image.Title,
+		Link:       msg.image.Link,
+		PostLink:   msg.image.PostLink,
+		State:      msg.state.String(),
+		Reason:     msg.reason,
+		Bytes:      msg.bytes,
+		DurationMs: msg.duration.Milliseconds(),
+		Path:       msg.path,
+	})
+}
+
+// addTarget records a target that could not be scraped within the report.
+func (r *Report) addTarget(err *TargetError) {
+	r.Targets = append(r.Targets, ReportTarget{
+		Subreddit: err.Target,
+		State:     err.State(),
+		Reason:    err.Err.Error(),
+	})
+}
+
+// supportedReportFormat returns true if the extension of the given path is a
+// report format that can be written.
+func supportedReportFormat(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".json" || ext == ".csv"
+}
+
+// Write writes the report to the given path, the format is determined by the
+// extension of the path, supporting json and csv.
+func (r *Report) Write(path string) error {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return r.writeJSON(path)
+	case ".csv":
+		return r.writeCSV(path)
+	}
+
+	return fmt.Errorf("unsupported report format '%v', expected .json or .csv", filepath.Ext(path))
+}
+
+func (r *Report) writeJSON(path string) error {
+	// ensure a empty run is written as a empty list and not null.
+	if r.Items == nil {
+		r.Items = []ReportEntry{}
+	}
+
+	if r.Targets == nil {
+		r.Targets = []ReportTarget{}
+	}
+
+	data, err := json.MarshalIndent(r, "", "  ")
+
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, data, 0644)
+}
+
+func (r *Report) writeCSV(path string) error {
+	out, err := os.Create(path)
+
+	if err != nil {
+		return err
+	}
+
+	w := csv.NewWriter(out)
+
+	_ = w.Write([]string{"id", "imageId", "subreddit", "title", "link", "postLink",
+		"state", "reason", "bytes", "durationMs", "path"})
+
+	for _, item := range r.Items {
+		_ = w.Write([]string{item.Id, item.ImageId, item.Subreddit, item.Title, item.Link, item.PostLink,
+			item.State, item.Reason, strconv.FormatInt(item.Bytes, 10),
+			strconv.FormatInt(item.DurationMs, 10), item.Path})
+	}
+
+	// targets that could not be scraped have no items, so are written as a row
+	// of their own containing only the sub reddit, state and reason.
+	for _, target := range r.Targets {
+		_ = w.Write([]string{"", "", target.Subreddit, "", "", "", target.State, target.Reason, "0", "0", ""})
+	}
+
+	w.Flush()
+
+	if err := w.Error(); err != nil {
+		_ = out.Close()
+		return err
+	}
+
+	return out.Close()
+}
+
+// ReadReport reads a report written by a previous run, the format is determined
+// by the extension of the path, supporting json and csv.
+func ReadReport(path string) (Report, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return readJSONReport(path)
+	case ".csv":
+		return readCSVReport(path)
+	}
+
+	return Report{}, fmt.Errorf("unsupported report format '%v', expected .json or .csv", filepath.Ext(path))
+}
+
+func readJSONReport(path string) (Report, error) {
+	data, err := os.ReadFile(path)
+
+	if err != nil {
+		return Report{}, err
+	}
+
+	var report Report
+
+	if err := json.Unmarshal(data, &report); err != nil {
+		return Report{}, fmt.Errorf("failed to parse report %v: %w", path, err)
+	}
+
+	return report, nil
+}
+
+func readCSVReport(path string) (Report, error) {
+	in, err := os.Open(path)
+
+	if err != nil {
+		return Report{}, err
+	}
+
+	defer in.Close()
+
+	rows, err := csv.NewReader(in).ReadAll()
+
+	if err != nil {
+		return Report{}, fmt.Errorf("failed to parse report %v: %w", path, err)
+	}
+
+	var report Report
+
+	// the first row is the header, rows without a image are the targets that
+	// could not be scraped.
+	for i, row := range rows {
+		if i == 0 || len(row) != 11 {
+			continue
+		}
+
+		if row[0] == "" && row[4] == "" {
+			report.Targets = append(report.Targets, ReportTarget{Subreddit: row[2], State: row[6], Reason: row[7]})
+			continue
+		}
+
+		bytes, _ := strconv.ParseInt(row[8], 10, 64)
+		duration, _ := strconv.ParseInt(row[9], 10, 64)
+
+		report.Items = append(report.Items, ReportEntry{Id: row[0], ImageId: row[1], Subreddit: row[2], Title: row[3],
+			Link: row[4], PostLink: row[5], State: row[6], Reason: row[7], Bytes: bytes, DurationMs: duration, Path: row[10]})
+
+		// the summary counts are not written to the csv report.
+		switch row[6] {
+		case DownloadState(SUCCESS).String():
+			report.Downloaded += 1
+		case DownloadState(SKIPPED).String():
+			report.Skipped += 1
+		case DownloadState(FAILED).String():
+			report.Failed += 1
+		case DownloadState(REMOVED).String():
+			report.Removed += 1
+		}
+	}
+
+	return report, nil
+}
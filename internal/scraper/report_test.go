@@ -0,0 +1,141 @@
+package scraper
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stephensli/mavic/internal/reddit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sampleReportImage creates a image from r/cute with the given link.
+func sampleReportImage(link string) reddit.Image {
+	return reddit.Image{Id: "d4zpeh", ImageId: "4kxuzo2zidn32", Subreddit: "cute",
+		Link: link, Title: "Army, \"Crawling\""}
+}
+
+// sampleReport builds a report with a single item in each of the final states.
+func sampleReport() Report {
+	var report Report
+	image := sampleReportImage("https://i.redd.it/4kxuzo2zidn32.gif")
+
+	report.add(updateState{image: image, state: SUCCESS, path: "cute/4kxuzo2zidn32.gif",
+		bytes: 2048, duration: 1500 * time.Millisecond})
+	report.add(updateState{image: image, state: SKIPPED, reason: "file already exists", path: "cute/4kxuzo2zidn32.gif"})
+	report.add(updateState{image: image, state: FAILED, reason: "connection reset", path: "cute/4kxuzo2zidn32.gif"})
+
+	return report
+}
+
+// TestReportWriteJSON ensures every item and the summary counts are written
+// to the json report.
+func TestReportWriteJSON(t *testing.T) {
+	report := sampleReport()
+	path := filepath.Join(t.TempDir(), "report.json")
+	require.NoError(t, report.Write(path))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	var read Report
+	require.NoError(t, json.Unmarshal(data, &read))
+
+	assert.Equal(t, report, read)
+	assert.Equal(t, 1, read.Downloaded)
+	assert.Equal(t, 1, read.Skipped)
+	assert.Equal(t, 1, read.Failed)
+	assert.Equal(t, "SUCCESS", read.Items[0].State)
+	assert.Equal(t, int64(1500), read.Items[0].DurationMs)
+	assert.Equal(t, "connection reset", read.Items[2].Reason)
+}
+
+// TestReportWriteCSV ensures a header and one row per item is written to the
+// csv report.
+func TestReportWriteCSV(t *testing.T) {
+	report := sampleReport()
+	path := filepath.Join(t.TempDir(), "report.csv")
+	require.NoError(t, report.Write(path))
+
+	out, err := os.Open(path)
+	require.NoError(t, err)
+	defer out.Close()
+
+	rows, err := csv.NewReader(out).ReadAll()
+	require.NoError(t, err)
+
+	assert.Len(t, rows, 4)
+	assert.Equal(t, "state", rows[0][6])
+	assert.Equal(t, []string{"SUCCESS", "", "2048", "1500"}, rows[1][6:10])
+	assert.Equal(t, "Army, \"Crawling\"", rows[1][3])
+	assert.Equal(t, "file already exists", rows[2][7])
+}
+
+// TestReportWriteTargets ensures the targets that could not be scraped are
+// written with their distinct state to both report formats.
+func TestReportWriteTargets(t *testing.T) {
+	report := sampleReport()
+	report.addTarget(&TargetError{Target: "secret", Err: ErrPrivateSubreddit})
+	report.addTarget(&TargetError{Target: "gone", Err: ErrBannedSubreddit})
+
+	dir := t.TempDir()
+	require.NoError(t, report.Write(filepath.Join(dir, "report.json")))
+	require.NoError(t, report.Write(filepath.Join(dir, "report.csv")))
+
+	data, err := os.ReadFile(filepath.Join(dir, "report.json"))
+	require.NoError(t, err)
+
+	var read Report
+	require.NoError(t, json.Unmarshal(data, &read))
+
+	assert.Equal(t, []ReportTarget{
+		{Subreddit: "secret", State: "PRIVATE", Reason: "subreddit is private"},
+		{Subreddit: "gone", State: "BANNED", Reason: "subreddit is banned"},
+	}, read.Targets)
+
+	out, err := os.Open(filepath.Join(dir, "report.csv"))
+	require.NoError(t, err)
+	defer out.Close()
+
+	rows, err := csv.NewReader(out).ReadAll()
+	require.NoError(t, err)
+
+	assert.Len(t, rows, 6)
+	assert.Equal(t, []string{"secret", "PRIVATE"}, []string{rows[4][2], rows[4][6]})
+	assert.Equal(t, "subreddit is banned", rows[5][7])
+}
+
+// TestReadReport ensures a report written by a previous run is read back the
+// same from both report formats.
+func TestReadReport(t *testing.T) {
+	report := sampleReport()
+	report.addTarget(&TargetError{Target: "secret", Err: ErrPrivateSubreddit})
+
+	dir := t.TempDir()
+
+	for _, name := range []string{"report.json", "report.csv"} {
+		require.NoError(t, report.Write(filepath.Join(dir, name)))
+
+		read, err := ReadReport(filepath.Join(dir, name))
+		require.NoError(t, err)
+		assert.Equal(t, report, read, name)
+	}
+
+	_, err := ReadReport(filepath.Join(dir, "report.xml"))
+	assert.Error(t, err)
+}
+
+// TestReportWriteUnsupported ensures a report with a unknown extension is
+// rejected over writing a file in a unexpected format.
+func TestReportWriteUnsupported(t *testing.T) {
+	report := sampleReport()
+	path := filepath.Join(t.TempDir(), "report.xml")
+
+	assert.Error(t, report.Write(path))
+	assert.False(t, supportedReportFormat(path))
+	assert.True(t, supportedReportFormat("out.CSV"))
+}
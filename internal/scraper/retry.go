@@ -0,0 +1,174 @@
+package scraper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// maxRetryAfter is the longest a Retry-After header will be honoured for,
+// protecting against a server asking the run to stall for hours.
+const maxRetryAfter = 5 * time.Minute
+
+// errTruncated is returned when the connection closed before the full body was
+// received, which is worth retrying (and resuming).
+var errTruncated = errors.New("response truncated")
+
+// StatusError is returned when a server responds with a unexpected status code,
+// including how long the server asked to wait before trying again.
+type StatusError struct {
+	// The http status code of the response.
+	StatusCode int
+	// The http status text of the response, e.g "404 Not Found".
+	Status string
+	// How long the server asked to wait before retrying, zero when not given.
+	RetryAfter time.Duration
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status %v", e.Status)
+}
+
+// newStatusError creates a status error from the response, parsing the
+// Retry-After header if one was given.
+func newStatusError(resp *http.Response) *StatusError {
+	return &StatusError{
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+	}
+}
+
+// parseRetryAfter parses the Retry-After header, which can either be the number
+// of seconds to wait or the http date after which to retry.
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		if wait := time.Until(date); wait > 0 {
+			return wait
+		}
+	}
+
+	return 0
+}
+
+// isRetryable determines if the given error is transient and worth retrying.
+// Timeouts, network failures, truncated bodies, rate limits (429) and server
+// errors (5xx) are retryable, while everything else (e.g 404, 403, or failing
+// to write to disk) will fail the same way again and is permanent.
+func isRetryable(err error) bool {
+	// a cancelled run is wrapped as a network error, but will never succeed.
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var statusErr *StatusError
+
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode == http.StatusTooManyRequests || statusErr.StatusCode >= 500
+	}
+
+	var netErr net.Error
+
+	if errors.As(err, &netErr) {
+		return true
+	}
+
+	return errors.Is(err, errTruncated) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// RetryPolicy is the policy used for retrying listing and media requests that
+// failed with a retryable error, waiting with a exponential backoff between
+// each of the attempts.
+type RetryPolicy struct {
+	// The max number of attempts, including the first attempt.
+	MaxAttempts int
+	// The delay before the first retry, doubling with each attempt after.
+	BaseDelay time.Duration
+	// The max delay between attempts, excluding Retry-After.
+	MaxDelay time.Duration
+	// sleep waits for the given duration between attempts, replaced in tests.
+	sleep func(context.Context, time.Duration) error
+	// onRetry is called (if not nil) with the error of each attempt that is
+	// about to be retried.
+	onRetry func(err error)
+}
+
+// delay returns how long to wait before the given retry attempt (starting at 1).
+// The server's Retry-After is honoured if given, otherwise the delay is a
+// exponential backoff with jitter, so concurrent failures don't retry in step.
+func (p RetryPolicy) delay(attempt int, err error) time.Duration {
+	var statusErr *StatusError
+
+	if errors.As(err, &statusErr) && statusErr.RetryAfter > 0 {
+		if statusErr.RetryAfter > maxRetryAfter {
+			return maxRetryAfter
+		}
+
+		return statusErr.RetryAfter
+	}
+
+	backoff := p.BaseDelay << (attempt - 1)
+
+	if backoff > p.MaxDelay || backoff <= 0 {
+		backoff = p.MaxDelay
+	}
+
+	// equal jitter, always waiting at least half of the backoff.
+	half := backoff / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// do calls the given function until it succeeds, fails with a permanent error
+// or the max number of attempts is reached, returning the last error. Waiting
+// between attempts stops as soon as the context is cancelled.
+func (p RetryPolicy) do(ctx context.Context, fn func() error) error {
+	sleep := p.sleep
+
+	if sleep == nil {
+		sleep = sleepContext
+	}
+
+	var err error
+
+	for attempt := 1; ; attempt++ {
+		if err = fn(); err == nil || !isRetryable(err) || attempt >= p.MaxAttempts {
+			return err
+		}
+
+		if p.onRetry != nil {
+			p.onRetry(err)
+		}
+
+		if sleepErr := sleep(ctx, p.delay(attempt, err)); sleepErr != nil {
+			return err
+		}
+	}
+}
+
+// sleepContext waits for the given duration or until the context is cancelled,
+// returning the context error if cancelled.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
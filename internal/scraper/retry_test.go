@@ -0,0 +1,177 @@
+package scraper
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestIsRetryable ensures transient failures are retried and permanent ones are not.
+func TestIsRetryable(t *testing.T) {
+	assert.True(t, isRetryable(&StatusError{StatusCode: http.StatusTooManyRequests}))
+	assert.True(t, isRetryable(&StatusError{StatusCode: http.StatusBadGateway}))
+	assert.True(t, isRetryable(fmt.Errorf("wrapped: %w", errTruncated)))
+	assert.False(t, isRetryable(&StatusError{StatusCode: http.StatusNotFound}))
+	assert.False(t, isRetryable(&StatusError{StatusCode: http.StatusForbidden}))
+	assert.False(t, isRetryable(errEmptyResponse))
+	assert.False(t, isRetryable(os.ErrPermission))
+
+	// a request to a closed server is a network error.
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+
+	_, err := http.Get(server.URL)
+	assert.True(t, isRetryable(err))
+}
+
+// TestRetryPolicyDelay ensures the backoff grows exponentially within the jitter
+// bounds, is capped and that Retry-After takes priority.
+func TestRetryPolicyDelay(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 5, BaseDelay: time.Second, MaxDelay: 4 * time.Second}
+
+	for attempt, max := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 10: 4 * time.Second} {
+		delay := policy.delay(attempt, errTruncated)
+		assert.GreaterOrEqual(t, delay, max/2)
+		assert.LessOrEqual(t, delay, max)
+	}
+
+	assert.Equal(t, 30*time.Second, policy.delay(1, &StatusError{StatusCode: 429, RetryAfter: 30 * time.Second}))
+	assert.Equal(t, maxRetryAfter, policy.delay(1, &StatusError{StatusCode: 429, RetryAfter: time.Hour}))
+	assert.Equal(t, 2*time.Minute, parseRetryAfter("120"))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("soon"))
+}
+
+// TestRetryPolicyDo ensures retryable errors are retried up to the max attempts
+// while permanent errors return straight away.
+func TestRetryPolicyDo(t *testing.T) {
+	var slept []time.Duration
+	policy := RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Second,
+		sleep: func(_ context.Context, d time.Duration) error {
+			slept = append(slept, d)
+			return nil
+		}}
+
+	attempts := 0
+	err := policy.do(context.Background(), func() error {
+		attempts += 1
+		return &StatusError{StatusCode: http.StatusServiceUnavailable}
+	})
+
+	assert.Error(t, err)
+	assert.Equal(t, 3, attempts)
+	assert.Len(t, slept, 2)
+
+	attempts = 0
+	err = policy.do(context.Background(), func() error {
+		attempts += 1
+		return &StatusError{StatusCode: http.StatusNotFound}
+	})
+
+	assert.Error(t, err)
+	assert.Equal(t, 1, attempts)
+
+	attempts = 0
+	err = policy.do(context.Background(), func() error {
+		if attempts += 1; attempts < 2 {
+			return errTruncated
+		}
+
+		return nil
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2, attempts)
+}
+
+// TestDownloadImageRetry ensures a image that fails with a server error is
+// retried and reported as a success once the server recovers.
+func TestDownloadImageRetry(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests += 1; requests < 3 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		_, _ = w.Write(sampleJPEG)
+	}))
+
+	defer server.Close()
+
+	dir := t.TempDir()
+	s, err := NewScraper(Options{OutputDirectory: dir, PageType: "hot", Subreddits: []string{"cute"},
+		RetryAttempts: 3, RetryDelay: time.Millisecond})
+	require.NoError(t, err)
+
+	image := sampleReportImage(server.URL + "/image.jpg")
+
+	statusStream := make(chan updateState, 2)
+	s.downloadImage(context.Background(), statusStream, queuedImage{image: image, folder: "cute"})
+
+	<-statusStream
+	final := <-statusStream
+
+	require.EqualValues(t, SUCCESS, final.state, final.reason)
+	assert.Equal(t, 3, requests)
+	assert.FileExists(t, filepath.Join(dir, "cute", "image.jpg"))
+}
+
+// TestRetryPolicyDoCancelled ensures a cancelled context stops retrying straight
+// away over waiting for the next attempt.
+func TestRetryPolicyDoCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	policy := RetryPolicy{MaxAttempts: 3, BaseDelay: time.Hour, MaxDelay: time.Hour}
+	transient := &StatusError{StatusCode: http.StatusServiceUnavailable}
+
+	attempts := 0
+	err := policy.do(ctx, func() error {
+		attempts += 1
+		return transient
+	})
+
+	assert.Equal(t, transient, err)
+	assert.Equal(t, 1, attempts)
+	assert.False(t, isRetryable(fmt.Errorf("wrapped: %w", context.Canceled)))
+}
+
+// TestDownloadImageCancelled ensures a download cancelled part way through fails
+// without leaving the image or a partial download behind.
+func TestDownloadImageCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "1024")
+		_, _ = w.Write(sampleJPEG)
+		w.(http.Flusher).Flush()
+
+		cancel()
+		<-r.Context().Done()
+	}))
+
+	defer server.Close()
+
+	dir := t.TempDir()
+	s, err := NewScraper(Options{OutputDirectory: dir, PageType: "hot", Subreddits: []string{"cute"}})
+	require.NoError(t, err)
+
+	statusStream := make(chan updateState, 2)
+	s.downloadImage(ctx, statusStream, queuedImage{image: sampleReportImage(server.URL + "/image.jpg"), folder: "cute"})
+
+	<-statusStream
+	final := <-statusStream
+
+	assert.EqualValues(t, FAILED, final.state)
+	assert.NoFileExists(t, filepath.Join(dir, "cute", "image.jpg"))
+	assert.NoFileExists(t, filepath.Join(dir, "cute", "image.jpg"+partialExtension))
+}
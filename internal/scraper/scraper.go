@@ -1,18 +1,39 @@
 package scraper
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
 	"io/ioutil"
-	"log"
 	"net/http"
+	"net/url"
 	"os"
 	"path"
 	"strings"
+	"time"
 
 	"github.com/schollz/progressbar/v3"
+	"github.com/stephensli/mavic/internal/archive"
+	"github.com/stephensli/mavic/internal/auth"
+	"github.com/stephensli/mavic/internal/logging"
+	"github.com/stephensli/mavic/internal/metadata"
 	"github.com/stephensli/mavic/internal/reddit"
+	"github.com/stephensli/mavic/internal/thumbnail"
+)
+
+const (
+	// redditURL is the base url of the reddit api when accessed anonymously.
+	redditURL = "https://www.reddit.com"
+	// oauthRedditURL is the base url of the reddit api when authenticated.
+	oauthRedditURL = "https://oauth.reddit.com"
+	// savedTarget is the target of the saved posts of the authenticated user.
+	savedTarget = "saved"
+	// upvotedTarget is the target of the upvoted posts of the authenticated user.
+	upvotedTarget = "upvoted"
+	// maxListingLimit is the most posts reddit returns for a single listing, larger
+	// limits are paged through.
+	maxListingLimit = 100
 )
 
 // The progress bar of the downloading progress that os currently happening
@@ -28,8 +49,28 @@ const (
 	SUCCESS                   = iota
 	SKIPPED                   = iota
 	FAILED                    = iota
+	REMOVED                   = iota
 )
 
+// String returns the constant name of the download state, used when the
+// state is written out in a machine readable form.
+func (d DownloadState) String() string {
+	switch d {
+	case DOWNLOADING:
+		return "DOWNLOADING"
+	case SUCCESS:
+		return "SUCCESS"
+	case SKIPPED:
+		return "SKIPPED"
+	case FAILED:
+		return "FAILED"
+	case REMOVED:
+		return "REMOVED"
+	}
+
+	return "UNKNOWN"
+}
+
 // updateState is used to determine how a downloading progress has occurred and on
 // what subreddit that this happened.
 type updateState struct {
@@ -39,16 +80,33 @@ type updateState struct {
 	image reddit.Image
 	// The state that the downloading is currently in.
 	state DownloadState
+	// The reason the image was skipped or failed, empty otherwise.
+	reason string
+	// The destination path of the image on disk.
+	path string
+	// The number of bytes that was transferred during the download.
+	bytes int64
+	// How long the image has been processing for when the state was sent.
+	duration time.Duration
+}
+
+// queuedImage is a image queued to be downloaded, along with the folder within the
+// output directory (or archive) of the target it was found through. The image keeps
+// the sub reddit it was posted to, which differs from the target for the front page,
+// saved and upvoted posts.
+type queuedImage struct {
+	image reddit.Image
+	// the folder the image is written into, empty for the root.
+	folder string
+	// if set, the final state of the image is also sent to done, allowing the
+	// outcome of each queued image to be waited on.
+	done chan<- updateState
 }
 
 // Scraper is the type that will be containing all the configuration and
 // data used for the parsing process. Including references to already
 // downloaded ids + channels for the message and image pump.
 type Scraper struct {
-	// after is used for when you increase over the number of possible records, so the limit on
-	// reddit is 100, so if you ask for 110 images, first we must check the first 100 and then
-	// update after to 1, to see the next 10.
-	after int
 	// the options used for the scraping downloadRedditMetadata, this includes limits, pages, page types and
 	// sub reddits to be parsed. This is the central point of truth.
 	scrapingOptions Options
@@ -56,28 +114,86 @@ type Scraper struct {
 	// the user chooses a unsupported page type, then we will just default to reddits default
 	// which is currently hot.
 	supportedPageTypes map[string]bool
+	// the archive that completed downloads are streamed into, nil when the images
+	// are being downloaded directly into the output directory.
+	archive *archive.Archive
+	// the temporary directory images are downloaded into before being streamed into
+	// the archive, only used when writing into a archive.
+	stagingDirectory string
+	// the policy used to retry listing and media requests that fail with a
+	// transient error, e.g timeouts, rate limiting or server errors.
+	retryPolicy RetryPolicy
+	// the rate limiter shared by every request made to reddit, pacing requests
+	// based on the rate limit headers reddit responds with.
+	rateLimiter *RateLimiter
+	// the http client shared by every request made, both to reddit and for the
+	// images themselves.
+	client *http.Client
+	// the base url of the reddit api listings are requested from, the oauth api
+	// when authenticated.
+	baseUrl string
+	// the source of the access tokens sent with reddit requests, nil when reddit
+	// is accessed anonymously.
+	tokenSource *auth.TokenSource
+	// the targets to be scraped with the options of each target, parsed from the
+	// sub reddits of the scraping options.
+	targets []Target
+	// if only the images are being listed, in which case nothing is written to disk.
+	listOnly bool
+	// the logger the progress of the run is written to, discarding everything when
+	// no logger was given.
+	logger *logging.Logger
+	// the metrics the progress of the run is recorded into, nil when not exposed.
+	metrics *Metrics
 }
 
 // Start is exposed and called into when a new Scraper is created, this is called
-// when the cli commands are parsed and the application is ready to start.
-func (s Scraper) Start() {
+// when the cli commands are parsed and the application is ready to start. Targets
+// that fail to be scraped don't stop the run, they are returned as TargetErrors
+// once every other target has been processed. Cancelling the context stops the
+// run, in-flight downloads are cleaned up (or kept to be resumed), the report
+// and archive are still written for everything completed and the context error
+// is returned.
+func (s Scraper) Start(ctx context.Context) error {
 	// setup the progress bar on start with the rendering of the blank empty state
 	// otherwise the loading bar could be displayed before the contents are being
 	// parsed.
 	progressBar = progressbar.NewOptions(1, progressbar.OptionSetRenderBlankState(s.scrapingOptions.DisplayLoading))
 
-	done := make(chan interface{})
-	defer close(done)
+	if s.scrapingOptions.ArchivePath != "" {
+		var err error
+
+		if s.archive, err = archive.Open(s.scrapingOptions.ArchivePath); err != nil {
+			return fmt.Errorf("failed to open archive %v: %w", s.scrapingOptions.ArchivePath, err)
+		}
+
+		if s.stagingDirectory, err = os.MkdirTemp("", "mavic_staging"); err != nil {
+			s.archive.Abort()
+			return fmt.Errorf("failed to create staging directory: %w", err)
+		}
+
+		defer os.RemoveAll(s.stagingDirectory)
+	}
 
-	imageStream := s.downloadMetadata(done, progressBar, s.scrapingOptions.Subreddits)
+	// the errors of the targets that failed, only read once the metadata stream
+	// has been closed which happens before the status stream is closed.
+	var targetErrors TargetErrors
+	imageStream := s.downloadMetadata(ctx, progressBar, s.targets, &targetErrors)
 
 	// The downloaded images once download will pump a message to this channel
 	// which will log back out to the user the information they are expecting
 	// to be notified that they have been downloaded.
-	downloadedMessagePumpChannel := s.downloadImages(done, imageStream)
-	var downloaded, failed, skipped int
+	downloadedMessagePumpChannel := s.downloadImages(ctx, imageStream)
+	var downloaded, failed, skipped, removed int
+	var report Report
 
 	for msg := range downloadedMessagePumpChannel {
+		s.recordState(msg)
+
+		if msg.state != DOWNLOADING {
+			report.add(msg)
+		}
+
 		var downloadState string
 		var addingAmount = 1
 
@@ -98,6 +214,10 @@ func (s Scraper) Start() {
 			downloadState = "Failed Downloading"
 			failed += 1
 			break
+		case REMOVED:
+			downloadState = "Removed"
+			removed += 1
+			break
 		}
 
 		if s.scrapingOptions.DisplayLoading {
@@ -106,19 +226,68 @@ func (s Scraper) Start() {
 		}
 	}
 
+	summary := fmt.Sprintf("%v images processed. Downloaded %v, skipped %v, removed %v and failed %v.",
+		progressBar.GetMax(), downloaded, skipped, removed, failed)
+
+	for _, targetErr := range targetErrors {
+		report.addTarget(targetErr)
+	}
+
+	if len(targetErrors) > 0 {
+		summary += fmt.Sprintf(" %v subreddits could not be scraped.", len(targetErrors))
+	}
+
+	// when interrupted only part of the images were processed, so the summary
+	// is always shown for what was completed before stopping.
+	if ctx.Err() != nil {
+		summary = "Interrupted. " + summary
+	}
+
+	finished := "run finished"
+
+	if ctx.Err() != nil {
+		finished = "run interrupted"
+	}
+
+	s.logger.Info(finished, "processed", downloaded+skipped+removed+failed, "downloaded", downloaded,
+		"skipped", skipped, "removed", removed, "failed", failed, "failedSubreddits", len(targetErrors))
+
 	if s.scrapingOptions.DisplayLoading {
-		progressBar.Describe(fmt.Sprintf("%v images processed. Downloaded %v, skipped %v and failed %v.",
-			progressBar.GetMax(), downloaded, skipped, failed))
+		progressBar.Describe(summary)
 		_ = progressBar.Finish()
 	}
+
+	if s.archive != nil {
+		if err := s.archive.Close(); err != nil {
+			return fmt.Errorf("failed to write archive %v: %w", s.scrapingOptions.ArchivePath, err)
+		}
+	}
+
+	if s.scrapingOptions.ReportPath != "" {
+		if err := report.Write(s.scrapingOptions.ReportPath); err != nil {
+			return fmt.Errorf("failed to write report %v: %w", s.scrapingOptions.ReportPath, err)
+		}
+	}
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	if len(targetErrors) > 0 {
+		return targetErrors
+	}
+
+	return nil
 }
 
 // NewRedditScraper creates a instance of the reddit reddit used for taking images
 // from the reddit site and downloading them into the given directory. Additionally
-// sets the default options and data into the reddit reddit.
-func NewScraper(options Options) Scraper {
+// sets the default options and data into the reddit reddit. Invalid options are
+// returned as errors before anything is scraped.
+func NewScraper(options Options) (Scraper, error) {
 	redditScraper := Scraper{
-		after: 0,
+		logger:  options.Logger,
+		metrics: options.Metrics,
 		supportedPageTypes: map[string]bool{"hot": true, "new": true, "rising": true, "best": true,
 			"top-hour": true, "top-week": true, "top-month": true, "top-year": true, "top-all": true, "top": true,
 			"controversial-hour": true, "controversial-week": true, "controversial-month": true,
@@ -130,68 +299,186 @@ func NewScraper(options Options) Scraper {
 	// type is not valid. Determined it will exit earlier over
 	// trying to handle it later to improve code quality.
 	if !redditScraper.supportedPageTypes[options.PageType] {
-		log.Fatalf("Invalid page type '%v' used, reference README for valid page types.\n", options.PageType)
+		return Scraper{}, fmt.Errorf("%w '%v', reference README for valid page types", ErrInvalidPageType, options.PageType)
 	}
 
-	if options.ImageLimit <= 0 || options.ImageLimit > 500 {
-		options.ImageLimit = 50
+	if options.ReportPath != "" && !supportedReportFormat(options.ReportPath) {
+		return Scraper{}, fmt.Errorf("%w: '%v'", ErrInvalidReportPath, options.ReportPath)
 	}
 
-	if options.ImageLimit > 100 {
-		fmt.Println("Option 'limit' is currently enforced to 100 or les due ot a on going problem")
-		options.ImageLimit = 100
+	if options.ArchivePath != "" && !archive.Supported(options.ArchivePath) {
+		return Scraper{}, fmt.Errorf("%w: '%v'", ErrInvalidArchivePath, options.ArchivePath)
+	}
+
+	client, err := NewHTTPClient(options)
+
+	if err != nil {
+		return Scraper{}, err
+	}
+
+	if options.Metrics != nil {
+		client.Transport = &metricsTransport{base: client.Transport, metrics: options.Metrics}
+	}
+
+	redditScraper.client = client
+	redditScraper.baseUrl = redditURL
+
+	if !options.Credentials.Empty() {
+		if err := options.Credentials.Validate(); err != nil {
+			return Scraper{}, err
+		}
+
+		redditScraper.tokenSource = auth.NewTokenSource(client, options.Credentials, options.TokenURL)
+		redditScraper.baseUrl = oauthRedditURL
+	}
+
+	if options.ImageLimit <= 0 || options.ImageLimit > 500 {
+		options.ImageLimit = 50
 	}
 
 	if options.FrontPage {
 		options.Subreddits = append(options.Subreddits, "frontpage")
 	}
 
+	// the saved and upvoted posts belong to a user, so can only be accessed when
+	// authenticated as that user.
+	if (options.Saved || options.Upvoted) && options.Credentials.Username == "" {
+		return Scraper{}, ErrUserRequired
+	}
+
+	if options.Saved {
+		options.Subreddits = append(options.Subreddits, savedTarget)
+	}
+
+	if options.Upvoted {
+		options.Subreddits = append(options.Subreddits, upvotedTarget)
+	}
+
+	if options.RetryAttempts <= 0 {
+		options.RetryAttempts = 1
+	}
+
+	if options.RetryDelay <= 0 {
+		options.RetryDelay = time.Second
+	}
+
+	redditScraper.rateLimiter = NewRateLimiter(func(wait time.Duration) {
+		options.Logger.Warn("reddit rate limit reached, waiting for the rate limit to reset", "wait", wait.Round(time.Second))
+		options.Metrics.rateLimited(wait)
+	})
+
+	redditScraper.retryPolicy = RetryPolicy{
+		MaxAttempts: options.RetryAttempts,
+		BaseDelay:   options.RetryDelay,
+		MaxDelay:    time.Minute,
+		onRetry: func(err error) {
+			options.Logger.Debug("retrying request", "error", err)
+			options.Metrics.retried()
+		},
+	}
+
+	if len(options.Subreddits) == 0 {
+		return Scraper{}, ErrNoSubreddits
+	}
+
+	defaults := Target{PageType: options.PageType, Limit: options.ImageLimit}
+
+	for _, spec := range options.Subreddits {
+		target, err := ParseTarget(spec, defaults)
+
+		if err != nil {
+			return Scraper{}, err
+		}
+
+		if !redditScraper.supportedPageTypes[target.PageType] {
+			return Scraper{}, fmt.Errorf("%w '%v' for r/%v, reference README for valid page types",
+				ErrInvalidPageType, target.PageType, target.Name)
+		}
+
+		if target.Limit <= 0 || target.Limit > 500 {
+			target.Limit = options.ImageLimit
+		}
+
+		redditScraper.targets = append(redditScraper.targets, target)
+	}
+
 	redditScraper.scrapingOptions = options
-	return redditScraper
+	return redditScraper, nil
 }
 
 // downloads the metadata for a given sub and syncs with a sync group. This will download
 // the data, parse it and pump all the images into the download image stream that will
 // perform a fan out approach to download all the images.
-func (s Scraper) downloadMetadata(done <-chan interface{}, progressBar *progressbar.ProgressBar, subreddit []string) <-chan reddit.Image {
-	imageStream := make(chan reddit.Image)
+func (s Scraper) downloadMetadata(ctx context.Context, progressBar *progressbar.ProgressBar, targets []Target,
+	targetErrors *TargetErrors) <-chan queuedImage {
+	imageStream := make(chan queuedImage)
 
 	go func() {
 		defer close(imageStream)
 
-		for _, sub := range subreddit {
+		for _, target := range targets {
+			sub := target.Name
+
 			select {
-			case <-done:
+			case <-ctx.Done():
 				return
 			default:
 			}
 
-			listings, _ := s.gatherRedditFeed(sub)
-			links := parseLinksFromListings(listings)
+			listings, err := s.gatherRedditFeed(ctx, target)
 
-			dir := path.Join(s.scrapingOptions.OutputDirectory, sub)
+			// a cancelled run is not a failure of the target.
+			if ctx.Err() != nil {
+				return
+			}
 
-			// if we are only going into the root folder, there is no reason
-			// for us to be creating any of the sub folders, just the root.
-			if s.scrapingOptions.RootFolderOnly {
-				dir = s.scrapingOptions.OutputDirectory
+			if err != nil {
+				targetErr := &TargetError{Target: sub, Err: err}
+				*targetErrors = append(*targetErrors, targetErr)
+				s.logger.Warn("skipping subreddit", "subreddit", sub, "state", targetErr.State(), "error", err)
+
+				if s.scrapingOptions.DisplayLoading {
+					progressBar.Describe(fmt.Sprintf("Skipping r/%s (%s), %v...", sub, targetErr.State(), err))
+				}
+
+				continue
 			}
 
-			if _, err := os.Stat(dir); os.IsNotExist(err) {
+			links := parseLinksFromListings(listings)
+
+			// the saved and upvoted feeds are paged through until the limit is
+			// reached, so the last page could take it over the limit.
+			if len(links) > target.Limit {
+				links = links[:target.Limit]
+			}
+
+			s.logger.Debug("fetched listing", "subreddit", sub, "images", len(links))
+			s.metrics.listingFetched(sub)
+			dir := path.Join(s.scrapingOptions.OutputDirectory, s.targetFolder(target))
+
+			// archives are written from the staging directory, so the output
+			// directory is never touched.
+			if _, err := os.Stat(dir); os.IsNotExist(err) && s.archive == nil && !s.listOnly {
 				_ = os.MkdirAll(dir, os.ModePerm)
 			}
 
+			// any partial downloads left from a previous run that was killed part
+			// way through are removed, they will be downloaded again in full.
+			if s.archive == nil && !s.listOnly {
+				removeStalePartials(dir)
+			}
+
 			progressBar.ChangeMax(progressBar.GetMax() + len(links))
 
-			for _, image := range links {
-				// reassign the sub reddit since it could be the front page and
-				// the front page folder is which we want the folder to enter into.
-				image.Subreddit = sub
+			// the images keep the sub reddit they were posted to, while being
+			// written into the folder of the target (e.g the front page folder).
+			folder := s.targetFolder(target)
 
+			for _, image := range links {
 				select {
-				case <-done:
+				case <-ctx.Done():
 					return
-				case imageStream <- image:
+				case imageStream <- queuedImage{image: image, folder: folder}:
 				}
 			}
 		}
@@ -203,7 +490,7 @@ func (s Scraper) downloadMetadata(done <-chan interface{}, progressBar *progress
 // Iterates through the download image pump channel and constantly blocks
 // and takes the images pushed to it to be downloaded. calling into the
 // download image each time, until closed.
-func (s Scraper) downloadImages(done <-chan interface{}, imageStream <-chan reddit.Image) <-chan updateState {
+func (s Scraper) downloadImages(ctx context.Context, imageStream <-chan queuedImage) <-chan updateState {
 	statusStream := make(chan updateState)
 
 	go func() {
@@ -211,13 +498,12 @@ func (s Scraper) downloadImages(done <-chan interface{}, imageStream <-chan redd
 
 		for img := range imageStream {
 			select {
-			case <-done:
+			case <-ctx.Done():
 				return
 			default:
 			}
 
-			outDir := path.Join(s.scrapingOptions.OutputDirectory, img.Subreddit)
-			s.downloadImage(statusStream, outDir, img)
+			s.downloadImage(ctx, statusStream, img)
 		}
 	}()
 
@@ -225,92 +511,442 @@ func (s Scraper) downloadImages(done <-chan interface{}, imageStream <-chan redd
 
 }
 
-// downloadImage takes in the directory, image and sync group used to
-// download a given reddit image to a given directory.
-func (s Scraper) downloadImage(statusStream chan<- updateState, outDir string, img reddit.Image) {
-	statusStream <- updateState{img, DOWNLOADING}
+// recordState logs the transition of a image into the given state and records it
+// within the metrics, called for every state sent on the status stream.
+func (s Scraper) recordState(msg updateState) {
+	s.logState(msg)
+	s.metrics.observe(msg)
+}
 
-	// if we are just going into the root, remove everything after the last forward slash.
-	if s.scrapingOptions.RootFolderOnly {
-		outDir = strings.Replace(outDir, img.Subreddit, "", 1)
+// logState logs the transition of a image into the given state. The start of a
+// download is only logged at the debug level, while removed and failed images are
+// logged as warnings and errors.
+func (s Scraper) logState(msg updateState) {
+	level := logging.LevelInfo
+	message := "downloaded image"
+
+	switch msg.state {
+	case DOWNLOADING:
+		level, message = logging.LevelDebug, "downloading image"
+	case SKIPPED:
+		message = "skipped image"
+	case REMOVED:
+		level, message = logging.LevelWarn, "image removed"
+	case FAILED:
+		level, message = logging.LevelError, "failed downloading image"
+	}
+
+	if !s.logger.Enabled(level) {
+		return
+	}
+
+	args := []interface{}{"state", msg.state.String(), "subreddit", msg.image.Subreddit, "id", msg.image.Id,
+		"link", msg.image.Link}
+
+	if msg.state != DOWNLOADING {
+		args = append(args, "path", msg.path, "bytes", msg.bytes, "duration", msg.duration)
 	}
 
-	// replace gif-v with mp4 for a preferred download as a gif-v file does not work really well on windows
-	// machines but require additional processing. While mp4s work fine.
-	if strings.HasSuffix(img.Link, "gifv") {
-		img.Link = img.Link[:len(img.Link)-4] + "mp4"
+	if msg.reason != "" {
+		args = append(args, "reason", msg.reason)
 	}
 
+	s.logger.Log(level, message, args...)
+}
+
+// preferredLink replace gif-v with mp4 for a preferred download as a gif-v file does not work
+// really well on windows machines but require additional processing. While mp4s work fine.
+func preferredLink(link string) string {
+	if strings.HasSuffix(link, "gifv") {
+		return link[:len(link)-4] + "mp4"
+	}
+
+	return link
+}
+
+// relativePath determines the path of the image relative to the output directory (or the
+// root of the archive), this is the folder of the target and the image id including the
+// file type.
+func relativePath(img queuedImage) string {
 	// the img id again but this time containing the file type,
 	// which allows us to determine the file type without having
 	// to do any fancy work.
-	imageIdSplit := strings.Split(img.Link, "/")
+	imageIdSplit := strings.Split(preferredLink(img.image.Link), "/")
 	imageId := imageIdSplit[len(imageIdSplit)-1]
 
+	return path.Join(img.folder, imageId)
+}
+
+// targetFolder determines the folder within the output directory (or the root of
+// the archive) the images of the given target are written into. This is the folder
+// of the target if one was given, otherwise the sub reddit folder unless everything
+// is going directly into the root. The same sub reddit can be given more than once
+// with different folders, so the folder always comes from the target itself.
+func (s Scraper) targetFolder(target Target) string {
+	if target.Folder != "" {
+		return target.Folder
+	}
+
+	// if we are only going into the root folder, there is no reason
+	// for us to be creating any of the sub folders, just the root.
+	if s.scrapingOptions.RootFolderOnly {
+		return ""
+	}
+
+	return target.Name
+}
+
+// downloadImage takes in the image and the status stream used to download a given
+// reddit image into the output directory (or archive), notifying the status stream
+// of the progress.
+func (s Scraper) downloadImage(ctx context.Context, statusStream chan<- updateState, queued queuedImage) {
+	start := time.Now()
+	img := queued.image
+	statusStream <- updateState{image: img, state: DOWNLOADING}
+
+	img.Link = preferredLink(img.Link)
+	relativePath := relativePath(queued)
+
+	// when writing into a archive, the images are first downloaded into the staging
+	// directory with the same layout before being streamed into the archive.
+	root := s.scrapingOptions.OutputDirectory
+
+	if s.archive != nil {
+		root = s.stagingDirectory
+	}
+
+	imagePath := path.Join(root, relativePath)
+
+	// finish sends the final state of the image, including how long the
+	// image took to process and where it was written too.
+	finish := func(state DownloadState, reason string, written int64) {
+		destination := imagePath
+
+		if s.archive != nil {
+			destination = s.scrapingOptions.ArchivePath + ":" + relativePath
+		}
+
+		msg := updateState{image: img, state: state, reason: reason, path: destination,
+			bytes: written, duration: time.Since(start)}
+
+		if queued.done != nil {
+			queued.done <- msg
+		}
+
+		statusStream <- msg
+	}
+
+	if s.archive != nil && s.archive.Contains(relativePath) {
+		finish(SKIPPED, "entry already exists in archive", 0)
+		return
+	}
+
 	// returning early if the file already exists, ensuring another check before we go and
 	// attempt to download the file, reducing the chance of re-downloading already existing
 	// posts.
-	imagePath := path.Join(outDir, imageId)
 	if _, fileErr := os.Stat(imagePath); !os.IsNotExist(fileErr) {
-		statusStream <- updateState{img, SKIPPED}
+		finish(SKIPPED, "file already exists", 0)
 		return
 	}
 
-	out, createErr := os.Create(imagePath)
+	_ = os.MkdirAll(path.Dir(imagePath), os.ModePerm)
+
+	// the bytes transferred includes all the attempts, a failed attempt that
+	// was part way through is resumed by the following attempt.
+	var written int64
 
-	// early return if the os failed to create any of the folders, since there is
-	// no reason to attempt to download the file if we don't have any where to
-	// write the file to after wards.
-	if createErr != nil {
-		statusStream <- updateState{img, FAILED}
+	err := s.retryPolicy.do(ctx, func() error {
+		attemptWritten, err := downloadToFile(ctx, s.client, imagePath, img.Link)
+		written += attemptWritten
+		return err
+	})
+
+	if errors.Is(err, errRemoved) {
+		finish(REMOVED, err.Error(), written)
 		return
 	}
 
-	defer Close(out)
-	resp, httpErr := http.Get(img.Link)
-
-	// early return if we failed to download the given file due to a
-	// unexpected http error.
-	if httpErr != nil {
-		statusStream <- updateState{img, FAILED}
+	if err != nil {
+		finish(FAILED, err.Error(), written)
 		return
 	}
 
-	defer Close(resp.Body)
-	_, ioErr := io.Copy(out, resp.Body)
+	// embedding is best effort, the image has been downloaded successfully and
+	// formats that don't support metadata (e.g gif) are expected to fail, any
+	// other failure is logged.
+	if s.scrapingOptions.EmbedMetadata {
+		if err := metadata.Embed(imagePath, imageMetadata(img)); err != nil && !errors.Is(err, metadata.ErrUnsupportedFormat) {
+			s.logger.Warn("failed embedding metadata", "subreddit", img.Subreddit, "id", img.Id, "path", imagePath,
+				"error", err)
+		}
+	}
 
-	if ioErr != nil {
-		statusStream <- updateState{img, FAILED}
-		return
+	// thumbnails are also best effort, videos are not supported and a image that
+	// fails to decode is still a successful download.
+	if s.scrapingOptions.ThumbnailSize > 0 {
+		if err := thumbnail.Generate(root, imagePath, s.scrapingOptions.ThumbnailSize); err != nil &&
+			!errors.Is(err, thumbnail.ErrUnsupportedFormat) {
+			s.logger.Warn("failed generating thumbnail", "subreddit", img.Subreddit, "id", img.Id, "path", imagePath,
+				"error", err)
+		}
+	}
+
+	if s.archive != nil {
+		if err := s.archiveImage(root, relativePath); err != nil {
+			finish(FAILED, err.Error(), written)
+			return
+		}
+	}
+
+	finish(SUCCESS, "", written)
+}
+
+// archiveImage streams a downloaded image and its thumbnail (if one was generated)
+// from the staging directory into the archive, removing them from the staging
+// directory once written.
+func (s Scraper) archiveImage(root string, relativePath string) error {
+	imagePath := path.Join(root, relativePath)
+	defer os.Remove(imagePath)
+
+	if err := s.archive.Add(relativePath, imagePath); err != nil {
+		return err
+	}
+
+	thumbPath, err := thumbnail.Path(root, imagePath)
+
+	if err != nil {
+		return nil
+	}
+
+	if _, err := os.Stat(thumbPath); err != nil {
+		return nil
 	}
 
-	statusStream <- updateState{img, SUCCESS}
+	defer os.Remove(thumbPath)
+	return s.archive.Add(path.Join(thumbnail.Directory, relativePath+".jpg"), thumbPath)
+}
+
+// imageMetadata converts the reddit image into the metadata that is embedded
+// into the downloaded file, expanding the relative post link into a full url.
+func imageMetadata(img reddit.Image) metadata.Metadata {
+	return metadata.Metadata{
+		Title:     img.Title,
+		Author:    img.Author.Name,
+		Subreddit: img.Subreddit,
+		Permalink: redditURL + img.PostLink,
+	}
 }
 
 // Downloads and parses the reddit json feed based on the sub reddit. Ensuring that
 // the sub reddit is not empty and ensuring that we send a valid user-agent to ensure
 // that reddit does not rate limit us
-func (s Scraper) gatherRedditFeed(sub string) (reddit.Listings, error) {
-	if strings.TrimSpace(sub) == "" {
+func (s Scraper) gatherRedditFeed(ctx context.Context, target Target) (reddit.Listings, error) {
+	if strings.TrimSpace(target.Name) == "" {
 		return reddit.Listings{}, errors.New("sub reddit is required for downloading")
 	}
 
-	client := &http.Client{}
-	req, _ := http.NewRequest("GET", s.determineRedditUrl(sub), nil)
-	req.Header.Set("user-agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64)")
+	if target.Name == savedTarget || target.Name == upvotedTarget {
+		return s.gatherUserFeed(ctx, target)
+	}
+
+	return s.gatherSubredditFeed(ctx, target)
+}
+
+// gatherSubredditFeed pages through the listing of the sub reddit (or front page),
+// since reddit returns at most 100 posts per listing, until the limit of posts
+// has been reached or there are no more posts.
+func (s Scraper) gatherSubredditFeed(ctx context.Context, target Target) (reddit.Listings, error) {
+	feed := reddit.Listings{Data: &reddit.ListingData{}}
+	after := ""
 
-	resp, err := client.Do(req)
+	for {
+		remaining := target.Limit - len(feed.Data.Children)
+
+		if remaining > maxListingLimit {
+			remaining = maxListingLimit
+		}
+
+		page, err := s.gatherListing(ctx, s.determineRedditUrl(target, remaining, after))
+
+		if err != nil {
+			return reddit.Listings{}, err
+		}
+
+		if page.Data == nil {
+			return feed, nil
+		}
+
+		feed.Data.Children = append(feed.Data.Children, page.Data.Children...)
+
+		if len(feed.Data.Children) >= target.Limit || len(page.Data.Children) == 0 ||
+			page.Data.After == nil || *page.Data.After == "" {
+			return feed, nil
+		}
+
+		after = *page.Data.After
+	}
+}
+
+// gatherListing downloads and parses a single reddit listing, retrying transient
+// failures based on the retry policy.
+func (s Scraper) gatherListing(ctx context.Context, link string) (reddit.Listings, error) {
+	var listings reddit.Listings
+
+	err := s.retryPolicy.do(ctx, func() error {
+		var err error
+		listings, err = s.fetchRedditFeed(ctx, link)
+		return err
+	})
+
+	return listings, err
+}
+
+// gatherUserFeed pages through the saved or upvoted posts of the authenticated
+// user, keeping only the link posts (saved comments are dropped), until the image
+// limit has been reached or there are no more posts.
+func (s Scraper) gatherUserFeed(ctx context.Context, target Target) (reddit.Listings, error) {
+	feed := reddit.Listings{Data: &reddit.ListingData{}}
+	after := ""
+
+	for {
+		link := fmt.Sprintf("%v/user/%v/%v.json?limit=%v&type=links&after=%v", s.baseUrl,
+			url.PathEscape(s.scrapingOptions.Credentials.Username), target.Name, maxListingLimit, url.QueryEscape(after))
+
+		page, err := s.gatherListing(ctx, link)
+
+		if err != nil {
+			return reddit.Listings{}, err
+		}
+
+		if page.Data == nil {
+			return feed, nil
+		}
+
+		for _, child := range page.Data.Children {
+			if child.Kind != nil && *child.Kind == "t3" && child.Data != nil {
+				feed.Data.Children = append(feed.Data.Children, child)
+			}
+		}
+
+		if len(parseLinksFromListings(feed)) >= target.Limit ||
+			page.Data.After == nil || *page.Data.After == "" {
+			return feed, nil
+		}
+
+		after = *page.Data.After
+	}
+}
+
+// fetchRedditFeed performs a single attempt at downloading and parsing the
+// reddit json listing at the given link.
+func (s Scraper) fetchRedditFeed(ctx context.Context, link string) (reddit.Listings, error) {
+	resp, err := s.redditRequest(ctx, link)
+
+	if err != nil {
+		return reddit.Listings{}, err
+	}
+
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
 
 	if err != nil {
-		log.Panic(err)
+		return reddit.Listings{}, err
 	}
 
-	defer Close(resp.Body)
-	body, _ := ioutil.ReadAll(resp.Body)
+	if err := unavailableSubreddit(resp, body); err != nil {
+		return reddit.Listings{}, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return reddit.Listings{}, newStatusError(resp)
+	}
 
 	return reddit.UnmarshalListing(body)
 }
 
+// redditRequest performs a request against the reddit api, paced by the rate
+// limiter. When authenticated the access token is sent with the request, and a
+// token reddit rejected is refreshed and the request made once more.
+func (s Scraper) redditRequest(ctx context.Context, link string) (*http.Response, error) {
+	for attempt := 1; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, "GET", link, nil)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if s.tokenSource != nil {
+			token, err := s.tokenSource.Token(ctx)
+
+			if err != nil {
+				return nil, err
+			}
+
+			req.Header.Set("Authorization", "bearer "+token)
+		}
+
+		if err := s.rateLimiter.Wait(ctx); err != nil {
+			return nil, err
+		}
+
+		resp, err := s.client.Do(req)
+
+		if err != nil {
+			return nil, err
+		}
+
+		s.rateLimiter.Update(resp)
+
+		if resp.StatusCode != http.StatusUnauthorized || s.tokenSource == nil || attempt > 1 {
+			return resp, nil
+		}
+
+		_ = resp.Body.Close()
+		s.tokenSource.Invalidate()
+	}
+}
+
+// redditError is the json body reddit responds with when a sub reddit cannot be
+// viewed, e.g {"reason": "private", "message": "Forbidden", "error": 403}.
+type redditError struct {
+	Reason  string `json:"reason"`
+	Message string `json:"message"`
+	Error   int    `json:"error"`
+}
+
+// unavailableSubreddit determines if the listing response is reddit stating the
+// sub reddit cannot be viewed, returning the matching error or nil if the sub
+// reddit is available. Reddit redirects sub reddits that don't exist to the sub
+// reddit search, which would otherwise be parsed as a empty listing.
+func unavailableSubreddit(resp *http.Response, body []byte) error {
+	if resp.Request != nil && strings.HasPrefix(resp.Request.URL.Path, "/subreddits/search") {
+		return ErrSubredditNotFound
+	}
+
+	if resp.StatusCode != http.StatusForbidden && resp.StatusCode != http.StatusNotFound {
+		return nil
+	}
+
+	var redditErr redditError
+	_ = json.Unmarshal(body, &redditErr)
+
+	switch redditErr.Reason {
+	case "banned":
+		return ErrBannedSubreddit
+	case "quarantined":
+		return ErrQuarantinedSubreddit
+	case "private", "gold_only":
+		return ErrPrivateSubreddit
+	}
+
+	if resp.StatusCode == http.StatusForbidden {
+		return ErrPrivateSubreddit
+	}
+
+	return ErrSubredditNotFound
+}
+
 // parseLinksFromListings parses all the links and core information out from
 // the listings into a more usable formatted listings to allow for a simpler
 // image downloading downloadRedditMetadata.
@@ -357,12 +993,12 @@ func parseLinksFromListings(listings reddit.Listings) []reddit.Image {
 	return returnableImages
 }
 
-// determineRedditUrl will take in a sub reddit that will be used to determine
-// what reddit url would be used based on the scraping options, this includes
-// setting and marking the image limit and what stage they are currently at.
+// determineRedditUrl will take in a target that will be used to determine
+// what reddit url would be used based on the options of the target, requesting
+// the given number of posts after the given post (empty for the first page).
 // (defaulting to hot)
-func (s Scraper) determineRedditUrl(sub string) string {
-	pageType := s.scrapingOptions.PageType
+func (s Scraper) determineRedditUrl(target Target, limit int, after string) string {
+	pageType := target.PageType
 	additional := ""
 
 	// if a page type is a type that supports having a time span (e.g top and controversial) then
@@ -374,21 +1010,12 @@ func (s Scraper) determineRedditUrl(sub string) string {
 		pageType = pageSplit[0]
 	}
 
-	if sub == "frontpage" {
-		return fmt.Sprintf("https://www.reddit.com/%v/.json?limit=%v&after=%v%v", pageType, s.scrapingOptions.ImageLimit, s.after, additional)
+	if target.Name == "frontpage" {
+		return fmt.Sprintf("%v/%v/.json?limit=%v&after=%v%v", s.baseUrl, pageType, limit, url.QueryEscape(after), additional)
 	}
 
-	url := fmt.Sprintf("https://www.reddit.com/r/%v/%v.json?limit=%v&after=%v%v",
-		sub, pageType, s.scrapingOptions.ImageLimit, s.after, additional)
+	link := fmt.Sprintf("%v/r/%v/%v.json?limit=%v&after=%v%v",
+		s.baseUrl, target.Name, pageType, limit, url.QueryEscape(after), additional)
 
-	return url
-}
-
-// Close is designed to handle a defer closed on a closer. Correctly and
-// fatally exiting if a error occurs on the close.
-func Close(c io.Closer) {
-	err := c.Close()
-	if err != nil {
-		log.Fatal(err)
-	}
+	return link
 }
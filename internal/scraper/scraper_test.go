@@ -1,12 +1,26 @@
 package scraper
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"log"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/stephensli/mavic/internal/auth"
+	"github.com/stephensli/mavic/internal/logging"
+	"github.com/stephensli/mavic/internal/reddit"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 )
 
@@ -46,7 +60,7 @@ func (suite *ScraperTestSuite) SetupTest() {
 	// create the sample scraper that can be used on each test but not enforced.
 	// Allows base generation samples to occur and additional sample scrapers
 	// could be created if needed.
-	suite.sampleScraper = NewScraper(suite.baseOptions)
+	suite.sampleScraper, _ = NewScraper(suite.baseOptions)
 }
 
 // TearDownTest ensures that after the tests are complete, that any folder
@@ -64,18 +78,17 @@ func (suite *ScraperTestSuite) TearDownTest() {
 }
 
 // TestNewScraperBadLimit ensures that if a bad upper limit is given or lower limit, then
-// the given value is reset back to the default (if lower e.g 0 or less) or to a reset of 100
-// due to a current limitation of not being able to support more than 100 per sub reddit.
+// the given value is reset back to the default (e.g 0 or less, or over 500).
 func (suite *ScraperTestSuite) TestNewScraperBadLimit() {
 	tests := []test{
-		{[]int{101}, 100}, {[]int{501}, 50},
-		{[]int{500}, 100}, {[]int{0}, 50},
+		{[]int{501}, 50}, {[]int{0}, 50},
 		{[]int{-1}, 50}, {[]int{-100}, 50},
 	}
 
 	for _, v := range tests {
 		suite.baseOptions.ImageLimit = v.data[0]
-		badLimit := NewScraper(suite.baseOptions)
+		badLimit, err := NewScraper(suite.baseOptions)
+		assert.NoError(suite.T(), err)
 
 		assert.NotEqual(suite.T(), badLimit.scrapingOptions.ImageLimit, v.data[0])
 		assert.Equal(suite.T(), badLimit.scrapingOptions.ImageLimit, v.answer)
@@ -90,11 +103,16 @@ func (suite *ScraperTestSuite) TestNewScraperGoodLimit() {
 		{data: []int{1}, answer: 1},
 		{data: []int{50}, answer: 50},
 		{data: []int{100}, answer: 100},
+		{data: []int{101}, answer: 101},
+		{data: []int{500}, answer: 500},
 	}
 
 	for _, v := range tests {
 		suite.baseOptions.ImageLimit = v.data[0]
-		assert.Equal(suite.T(), NewScraper(suite.baseOptions).scrapingOptions.ImageLimit, v.answer)
+		goodLimit, err := NewScraper(suite.baseOptions)
+
+		assert.NoError(suite.T(), err)
+		assert.Equal(suite.T(), goodLimit.scrapingOptions.ImageLimit, v.answer)
 	}
 }
 
@@ -102,7 +120,7 @@ func (suite *ScraperTestSuite) TestNewScraperGoodLimit() {
 // that the front page will be scrapped and the entry will be pushed onto the sub reddit
 // slice for scraping.
 func (suite *ScraperTestSuite) TestNewScraperFrontPage() {
-	emptyScraper := NewScraper(suite.baseOptions)
+	emptyScraper, _ := NewScraper(suite.baseOptions)
 
 	// ensuring that if the given scraping options is false and that it does not have a
 	// front page entry into its sub reddit scraping.
@@ -110,7 +128,7 @@ func (suite *ScraperTestSuite) TestNewScraperFrontPage() {
 	assert.NotEqual(suite.T(), emptyScraper.scrapingOptions.Subreddits[len(emptyScraper.scrapingOptions.Subreddits)-1], "frontpage")
 
 	suite.baseOptions.FrontPage = true
-	frontScraper := NewScraper(suite.baseOptions)
+	frontScraper, _ := NewScraper(suite.baseOptions)
 
 	// ensuring that if marked, front page will be scraped and the entry is pushed onto
 	// the sub reddit stack.
@@ -118,25 +136,381 @@ func (suite *ScraperTestSuite) TestNewScraperFrontPage() {
 	assert.Equal(suite.T(), frontScraper.scrapingOptions.Subreddits[len(frontScraper.scrapingOptions.Subreddits)-1], "frontpage")
 }
 
+// TestNewScraperInvalidOptions ensures that invalid options are returned as the matching
+// error from construction over exiting the process, allowing the caller to decide how
+// to report them.
+func (suite *ScraperTestSuite) TestNewScraperInvalidOptions() {
+	invalidPageType := suite.baseOptions
+	invalidPageType.PageType = "sideways"
+
+	invalidReport := suite.baseOptions
+	invalidReport.ReportPath = "report.xml"
+
+	invalidArchive := suite.baseOptions
+	invalidArchive.ArchivePath = "out.rar"
+
+	noSubreddits := suite.baseOptions
+	noSubreddits.Subreddits = nil
+
+	tests := map[error]Options{
+		ErrInvalidPageType:    invalidPageType,
+		ErrInvalidReportPath:  invalidReport,
+		ErrInvalidArchivePath: invalidArchive,
+		ErrNoSubreddits:       noSubreddits,
+	}
+
+	for expected, options := range tests {
+		_, err := NewScraper(options)
+		assert.ErrorIs(suite.T(), err, expected)
+	}
+
+	// the front page alone is a valid target.
+	noSubreddits.FrontPage = true
+	_, err := NewScraper(noSubreddits)
+	assert.NoError(suite.T(), err)
+}
+
 // TestScraperSimpleDownload ensures that for a basic run, correct folders are created, content exists
 // that does not breach past the upper limit of the max number of images per site. Front page folder
 // is not created (since its not marked  true) and so fourth.
 func (suite *ScraperTestSuite) TestScraperSimpleDownload() {
-	suite.sampleScraper.Start()
+	suite.sampleScraper.Start(context.Background())
 }
 
 // TestScraperSimpleFrontPageDownload ensures that after a basic run with the additional setup of
 // enabling the front page, that the front page folder is created with content existing within.
 // this could fail if the N number of front page posts are not images.
 func (suite *ScraperTestSuite) TestScraperSimpleFrontPageDownload() {
-	suite.sampleScraper.Start()
+	suite.sampleScraper.Start(context.Background())
 }
 
 // TestScraperSimpleRootDownload Ensures that with a basic run, no sub folders for the sub reddits
 // dont exist, and all the content is in the root folder. No sub folders exist at all. Ensuring
 // that content was also downloaded.
 func (suite *ScraperTestSuite) TestScraperSimpleRootDownload() {
-	suite.sampleScraper.Start()
+	suite.sampleScraper.Start(context.Background())
+}
+
+// TestUnavailableSubreddit ensures the responses reddit gives for sub reddits that
+// cannot be viewed are detected over being parsed as a empty listing.
+func TestUnavailableSubreddit(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/r/missing/hot.json":
+			http.Redirect(w, r, "/subreddits/search.json?q=missing", http.StatusFound)
+		case "/r/private/hot.json":
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"reason": "private", "message": "Forbidden", "error": 403}`))
+		case "/r/quarantined/hot.json":
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"reason": "quarantined", "message": "Forbidden", "error": 403}`))
+		case "/r/banned/hot.json":
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"reason": "banned", "message": "Not Found", "error": 404}`))
+		case "/r/unknown/hot.json":
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"message": "Not Found", "error": 404}`))
+		default:
+			_, _ = w.Write([]byte(`{"kind": "Listing", "data": {"children": []}}`))
+		}
+	}))
+
+	defer server.Close()
+
+	tests := map[string]error{
+		"missing":     ErrSubredditNotFound,
+		"private":     ErrPrivateSubreddit,
+		"quarantined": ErrQuarantinedSubreddit,
+		"banned":      ErrBannedSubreddit,
+		"unknown":     ErrSubredditNotFound,
+		"cute":        nil,
+	}
+
+	for sub, expected := range tests {
+		resp, err := http.Get(fmt.Sprintf("%v/r/%v/hot.json", server.URL, sub))
+		require.NoError(t, err)
+
+		body, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+
+		assert.Equal(t, expected, unavailableSubreddit(resp, body), sub)
+	}
+}
+
+// TestFetchRedditFeedAuthenticated ensures authenticated listing requests send the
+// access token, and a token rejected by reddit is refreshed and the request retried.
+func TestFetchRedditFeedAuthenticated(t *testing.T) {
+	var tokens, rejected int
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/access_token":
+			tokens += 1
+			_, _ = fmt.Fprintf(w, `{"access_token": "token-%v", "expires_in": 3600}`, tokens)
+		case "/r/cute/hot.json":
+			// the first token is treated as revoked.
+			if r.Header.Get("Authorization") != "bearer token-2" {
+				rejected += 1
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			_, _ = w.Write([]byte(`{"kind": "Listing", "data": {"children": [{"data": {"id": "abc"}}]}}`))
+		}
+	}))
+
+	defer server.Close()
+
+	s, err := NewScraper(Options{PageType: "hot", Subreddits: []string{"cute"}, TokenURL: server.URL + "/api/v1/access_token",
+		Credentials: auth.Credentials{ClientID: "client", ClientSecret: "secret"}})
+	require.NoError(t, err)
+
+	assert.Equal(t, oauthRedditURL, s.baseUrl)
+	s.baseUrl = server.URL
+
+	listings, err := s.fetchRedditFeed(context.Background(), s.determineRedditUrl(s.targets[0], 50, ""))
+	require.NoError(t, err)
+
+	assert.Len(t, listings.Data.Children, 1)
+	assert.Equal(t, 2, tokens)
+	assert.Equal(t, 1, rejected)
+
+	_, err = NewScraper(Options{PageType: "hot", Subreddits: []string{"cute"},
+		Credentials: auth.Credentials{ClientID: "client", Username: "user"}})
+	assert.ErrorIs(t, err, auth.ErrMissingCredentials)
+}
+
+// TestGatherSubredditFeed ensures listings over the 100 posts reddit returns at
+// once are paged through until the limit is reached or there are no more posts.
+func TestGatherSubredditFeed(t *testing.T) {
+	var requested []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		requested = append(requested, query.Get("limit")+"/"+query.Get("after"))
+
+		limit, _ := strconv.Atoi(query.Get("limit"))
+		start, _ := strconv.Atoi(strings.TrimPrefix(query.Get("after"), "t3_"))
+
+		// the sub reddit has 230 posts in total.
+		var children []string
+
+		for i := start; i < start+limit && i < 230; i++ {
+			children = append(children, fmt.Sprintf(`{"kind": "t3", "data": {"id": "%v"}}`, i))
+		}
+
+		after := "null"
+
+		if start+len(children) < 230 {
+			after = fmt.Sprintf(`"t3_%v"`, start+len(children))
+		}
+
+		_, _ = fmt.Fprintf(w, `{"kind": "Listing", "data": {"after": %v, "children": [%v]}}`,
+			after, strings.Join(children, ","))
+	}))
+
+	defer server.Close()
+
+	s, err := NewScraper(Options{PageType: "new", Subreddits: []string{"cute::250", "aww::150", "frontpage::20"}})
+	require.NoError(t, err)
+	s.baseUrl = server.URL
+
+	feed, err := s.gatherRedditFeed(context.Background(), s.targets[0])
+	require.NoError(t, err)
+	assert.Len(t, feed.Data.Children, 230)
+	assert.Equal(t, []string{"100/", "100/t3_100", "50/t3_200"}, requested)
+
+	requested = nil
+	feed, err = s.gatherRedditFeed(context.Background(), s.targets[1])
+	require.NoError(t, err)
+	assert.Len(t, feed.Data.Children, 150)
+	assert.Equal(t, []string{"100/", "50/t3_100"}, requested)
+
+	requested = nil
+	feed, err = s.gatherRedditFeed(context.Background(), s.targets[2])
+	require.NoError(t, err)
+	assert.Len(t, feed.Data.Children, 20)
+	assert.Equal(t, []string{"20/"}, requested)
+}
+
+// TestGatherUserFeed ensures the saved posts of the user are paged through, keeping
+// only the link posts, until the limit is reached or there are no more posts.
+func TestGatherUserFeed(t *testing.T) {
+	pages := map[string]string{
+		"": `{"kind": "Listing", "data": {"after": "t3_b", "children": [
+			{"kind": "t1", "data": {"id": "comment"}},
+			{"kind": "t3", "data": {"id": "a", "post_hint": "image", "url": "https://i.redd.it/a.jpg", "domain": "i.redd.it",
+				"author": "user", "permalink": "/r/cute/comments/a/", "title": "a", "subreddit": "cute"}},
+			{"kind": "t3", "data": {"id": "self", "post_hint": "self", "url": "https://www.reddit.com/r/cute/"}}]}}`,
+		"t3_b": `{"kind": "Listing", "data": {"after": null, "children": [
+			{"kind": "t3", "data": {"id": "b", "post_hint": "image", "url": "https://i.redd.it/b.png", "domain": "i.redd.it",
+				"author": "user", "permalink": "/r/aww/comments/b/", "title": "b", "subreddit": "aww"}}]}}`,
+	}
+
+	var requested []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/access_token":
+			_, _ = w.Write([]byte(`{"access_token": "token", "expires_in": 3600}`))
+		case "/user/someone/saved.json":
+			requested = append(requested, r.URL.Query().Get("after"))
+			_, _ = w.Write([]byte(pages[r.URL.Query().Get("after")]))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+
+	defer server.Close()
+
+	options := Options{PageType: "hot", ImageLimit: 5, Saved: true, TokenURL: server.URL + "/api/v1/access_token",
+		Credentials: auth.Credentials{ClientID: "client", ClientSecret: "secret", Username: "someone", Password: "hunter2"}}
+
+	s, err := NewScraper(options)
+	require.NoError(t, err)
+	s.baseUrl = server.URL
+
+	assert.Equal(t, []string{"saved"}, s.scrapingOptions.Subreddits)
+
+	feed, err := s.gatherRedditFeed(context.Background(), s.targets[0])
+	require.NoError(t, err)
+
+	links := parseLinksFromListings(feed)
+	require.Len(t, links, 2)
+	assert.Equal(t, "a", links[0].Id)
+	assert.Equal(t, "b", links[1].Id)
+	assert.Equal(t, []string{"", "t3_b"}, requested)
+
+	// once the limit is reached no more pages are requested.
+	requested = nil
+	s.targets[0].Limit = 1
+
+	feed, err = s.gatherRedditFeed(context.Background(), s.targets[0])
+	require.NoError(t, err)
+	assert.Len(t, parseLinksFromListings(feed), 1)
+	assert.Equal(t, []string{""}, requested)
+
+	// the saved posts require a user to be authenticated.
+	options.Credentials = auth.Credentials{ClientID: "client", ClientSecret: "secret"}
+	_, err = NewScraper(options)
+	assert.ErrorIs(t, err, ErrUserRequired)
+}
+
+// TestTargetErrorState ensures each unavailable sub reddit has a distinct state.
+func TestTargetErrorState(t *testing.T) {
+	tests := map[error]string{
+		ErrSubredditNotFound:                          "NOT_FOUND",
+		ErrPrivateSubreddit:                           "PRIVATE",
+		ErrBannedSubreddit:                            "BANNED",
+		ErrQuarantinedSubreddit:                       "QUARANTINED",
+		&StatusError{StatusCode: 500}:                 "FAILED",
+		fmt.Errorf("wrapped: %w", ErrBannedSubreddit): "BANNED",
+	}
+
+	for err, expected := range tests {
+		assert.Equal(t, expected, (&TargetError{Target: "cute", Err: err}).State())
+	}
+}
+
+// TestLogState ensures every download state transition is logged as a event with
+// the image details, the start of a download only at the debug level.
+func TestLogState(t *testing.T) {
+	var buffer bytes.Buffer
+	logger, err := logging.New(&buffer, logging.FormatJSON, logging.LevelInfo)
+	require.NoError(t, err)
+
+	s := Scraper{logger: logger}
+	img := reddit.Image{Id: "abc", Subreddit: "cute", Link: "https://i.redd.it/abc.jpg"}
+
+	s.logState(updateState{image: img, state: DOWNLOADING})
+	s.logState(updateState{image: img, state: SUCCESS, path: "cute/abc.jpg", bytes: 1024, duration: time.Second})
+	s.logState(updateState{image: img, state: FAILED, path: "cute/abc.jpg", reason: "status 500"})
+
+	var events []map[string]interface{}
+	decoder := json.NewDecoder(&buffer)
+
+	for decoder.More() {
+		var event map[string]interface{}
+		require.NoError(t, decoder.Decode(&event))
+		events = append(events, event)
+	}
+
+	require.Len(t, events, 2)
+
+	assert.Equal(t, "INFO", events[0]["level"])
+	assert.Equal(t, "SUCCESS", events[0]["state"])
+	assert.Equal(t, "cute", events[0]["subreddit"])
+	assert.Equal(t, "abc", events[0]["id"])
+	assert.Equal(t, "cute/abc.jpg", events[0]["path"])
+	assert.Equal(t, float64(1024), events[0]["bytes"])
+	assert.Equal(t, "1s", events[0]["duration"])
+
+	assert.Equal(t, "ERROR", events[1]["level"])
+	assert.Equal(t, "FAILED", events[1]["state"])
+	assert.Equal(t, "status 500", events[1]["reason"])
+}
+
+// TestLogBestEffortFailures ensures metadata and thumbnails that fail for a
+// downloaded image are logged, except for formats that don't support them.
+func TestLogBestEffortFailures(t *testing.T) {
+	server := httptest.NewUnstartedServer(nil)
+	serverUrl := "http://" + server.Listener.Addr().String()
+
+	server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/r/cute/hot.json":
+			_, _ = fmt.Fprintf(w, `{"kind": "Listing", "data": {"children": [%v, {"kind": "t3", "data": {"id": "b",
+				"post_hint": "image", "url": "%v/images/b.webm", "domain": "i.redd.it", "author": "user",
+				"permalink": "/r/cute/comments/b/", "title": "b", "subreddit": "cute"}}]}}`, watchPost(serverUrl, "a"), serverUrl)
+		case "/images/a.jpg":
+			// a truncated jpeg, which can neither be embedded into or decoded.
+			w.Header().Set("Content-Type", "image/jpeg")
+			_, _ = w.Write(sampleJPEG)
+		case "/images/b.webm":
+			w.Header().Set("Content-Type", "video/webm")
+			_, _ = w.Write([]byte("\x1A\x45\xDF\xA3video content"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	server.Start()
+	defer server.Close()
+
+	var buffer bytes.Buffer
+	logger, err := logging.New(&buffer, logging.FormatJSON, logging.LevelWarn)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	s, err := NewScraper(Options{PageType: "hot", ImageLimit: 10, OutputDirectory: dir, Subreddits: []string{"cute"},
+		EmbedMetadata: true, ThumbnailSize: 64, Logger: logger})
+	require.NoError(t, err)
+
+	s.baseUrl = serverUrl
+	require.NoError(t, s.Start(context.Background()))
+
+	var events []map[string]interface{}
+	decoder := json.NewDecoder(&buffer)
+
+	for decoder.More() {
+		var event map[string]interface{}
+		require.NoError(t, decoder.Decode(&event))
+		events = append(events, event)
+	}
+
+	require.Len(t, events, 2)
+
+	assert.Equal(t, "failed embedding metadata", events[0]["msg"])
+	assert.Equal(t, "failed generating thumbnail", events[1]["msg"])
+
+	for _, event := range events {
+		assert.Equal(t, "WARN", event["level"])
+		assert.Equal(t, "cute", event["subreddit"])
+		assert.Equal(t, "a", event["id"])
+		assert.Equal(t, filepath.Join(dir, "cute", "a.jpg"), event["path"])
+		assert.NotEmpty(t, event["error"])
+	}
 }
 
 func TestScraperSuite(t *testing.T) {
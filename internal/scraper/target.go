@@ -0,0 +1,71 @@
+package scraper
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Target is a single sub reddit (or the front page, saved or upvoted posts) to be
+// scraped, with the options that apply to just this target.
+type Target struct {
+	// The name of the sub reddit, or frontpage, saved or upvoted.
+	Name string
+	// The page type the posts are taken from, e.g hot or top-week.
+	PageType string
+	// The max number of posts to take from the target.
+	Limit int
+	// The folder within the output directory (or archive) the images are written
+	// into, the sub reddit name (or the root when RootFolderOnly) when empty.
+	Folder string
+	// How often the target is polled when watching, the watch interval when zero.
+	Interval time.Duration
+}
+
+// ParseTarget parses a target in the "name:type:limit:folder" form, where every
+// part after the name is optional and an empty part (e.g "aww::25") keeps the
+// value of the given defaults. The folder is last so it can itself contain a colon.
+// The name can be followed by the interval the target is polled at when watching,
+// e.g "aww@15m:new", since a sub reddit name can never contain a @.
+func ParseTarget(spec string, defaults Target) (Target, error) {
+	parts := strings.SplitN(spec, ":", 4)
+
+	target := defaults
+	target.Name = strings.TrimSpace(parts[0])
+
+	if index := strings.Index(target.Name, "@"); index >= 0 {
+		interval, err := time.ParseDuration(strings.TrimSpace(target.Name[index+1:]))
+
+		if err != nil || interval <= 0 {
+			return Target{}, fmt.Errorf("%w '%v', the interval must be a positive duration, e.g 15m", ErrInvalidTarget, spec)
+		}
+
+		target.Name = strings.TrimSpace(target.Name[:index])
+		target.Interval = interval
+	}
+
+	if target.Name == "" {
+		return Target{}, fmt.Errorf("%w '%v', the sub reddit name is required", ErrInvalidTarget, spec)
+	}
+
+	if len(parts) > 1 && parts[1] != "" {
+		target.PageType = strings.TrimSpace(parts[1])
+	}
+
+	if len(parts) > 2 && parts[2] != "" {
+		limit, err := strconv.Atoi(strings.TrimSpace(parts[2]))
+
+		if err != nil {
+			return Target{}, fmt.Errorf("%w '%v', the limit must be a number", ErrInvalidTarget, spec)
+		}
+
+		target.Limit = limit
+	}
+
+	if len(parts) > 3 {
+		target.Folder = parts[3]
+	}
+
+	return target, nil
+}
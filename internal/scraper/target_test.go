@@ -0,0 +1,67 @@
+package scraper
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestParseTarget ensures each part of the target overrides the defaults, with
+// empty and missing parts keeping the defaults.
+func TestParseTarget(t *testing.T) {
+	defaults := Target{PageType: "hot", Limit: 50}
+
+	tests := map[string]Target{
+		"aww":                           {Name: "aww", PageType: "hot", Limit: 50},
+		"wallpapers:top-week:200":       {Name: "wallpapers", PageType: "top-week", Limit: 200},
+		"aww::25":                       {Name: "aww", PageType: "hot", Limit: 25},
+		"pics:new":                      {Name: "pics", PageType: "new", Limit: 50},
+		"earthporn:::landscapes":        {Name: "earthporn", PageType: "hot", Limit: 50, Folder: "landscapes"},
+		`wallpapers:top:10:D:\walls`:    {Name: "wallpapers", PageType: "top", Limit: 10, Folder: `D:\walls`},
+		" cute : top-all : 5 : kittens": {Name: "cute", PageType: "top-all", Limit: 5, Folder: " kittens"},
+		"aww@15m:new":                   {Name: "aww", PageType: "new", Limit: 50, Interval: 15 * time.Minute},
+		"aww @ 1h30m:::animals":         {Name: "aww", PageType: "hot", Limit: 50, Folder: "animals", Interval: 90 * time.Minute},
+	}
+
+	for spec, expected := range tests {
+		target, err := ParseTarget(spec, defaults)
+		require.NoError(t, err, spec)
+		assert.Equal(t, expected, target, spec)
+	}
+
+	for _, spec := range []string{"", ":top", "aww:hot:lots", "aww@soon", "aww@-5m", "@5m:new"} {
+		_, err := ParseTarget(spec, defaults)
+		assert.ErrorIs(t, err, ErrInvalidTarget, spec)
+	}
+}
+
+// TestNewScraperTargets ensures every target is given its own page type, limit and
+// folder, which are used for the listing url and where the images are written.
+func TestNewScraperTargets(t *testing.T) {
+	s, err := NewScraper(Options{PageType: "hot", ImageLimit: 50, RootFolderOnly: true,
+		Subreddits: []string{"wallpapers:top-week:80:walls", "aww::25", "pics:new:501", "gifs::200"}})
+	require.NoError(t, err)
+
+	assert.Equal(t, []Target{
+		{Name: "wallpapers", PageType: "top-week", Limit: 80, Folder: "walls"},
+		{Name: "aww", PageType: "hot", Limit: 25},
+		{Name: "pics", PageType: "new", Limit: 50},
+		{Name: "gifs", PageType: "hot", Limit: 200},
+	}, s.targets)
+
+	assert.Equal(t, "https://www.reddit.com/r/wallpapers/top.json?limit=80&after=&t=week",
+		s.determineRedditUrl(s.targets[0], 80, ""))
+	assert.Equal(t, "https://www.reddit.com/r/aww/hot.json?limit=25&after=t3_abc",
+		s.determineRedditUrl(s.targets[1], 25, "t3_abc"))
+
+	assert.Equal(t, "walls", s.targetFolder(s.targets[0]))
+	assert.Equal(t, "", s.targetFolder(s.targets[1]))
+
+	_, err = NewScraper(Options{PageType: "hot", Subreddits: []string{"aww:sideways"}})
+	assert.ErrorIs(t, err, ErrInvalidPageType)
+
+	_, err = NewScraper(Options{PageType: "hot", Subreddits: []string{"aww:hot:many"}})
+	assert.ErrorIs(t, err, ErrInvalidTarget)
+}
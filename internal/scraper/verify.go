@@ -0,0 +1,419 @@
+package scraper
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	// registering the decoders used to validate the downloaded images, only the
+	// first frame of a animated webp is decoded.
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+
+	"github.com/stephensli/mavic/internal/archive"
+	"github.com/stephensli/mavic/internal/thumbnail"
+	_ "golang.org/x/image/webp"
+)
+
+// mediaExtensions are the file extensions of the images and videos downloaded,
+// all other files within a download directory (e.g reports) are not verified.
+var mediaExtensions = map[string]bool{
+	".jpg": true, ".jpeg": true, ".png": true, ".gif": true, ".webp": true, ".mp4": true, ".webm": true,
+}
+
+// The problems a file within a download directory can have.
+const (
+	// ProblemBroken is a image or video that is empty, truncated or corrupt.
+	ProblemBroken = "BROKEN"
+	// ProblemMissing is a image the reports record as downloaded that no longer exists.
+	ProblemMissing = "MISSING"
+	// ProblemStalePartial is a partial download that cannot be resumed.
+	ProblemStalePartial = "STALE_PARTIAL"
+	// ProblemOrphanedThumbnail is a thumbnail of a image that no longer exists.
+	ProblemOrphanedThumbnail = "ORPHANED_THUMBNAIL"
+)
+
+// The ways a problem was fixed.
+const (
+	// FixDownloaded is a broken or missing image that was downloaded again.
+	FixDownloaded = "DOWNLOADED"
+	// FixRemoved is a file that was removed since it could not be downloaded again.
+	FixRemoved = "REMOVED"
+	// FixFailed is a problem that could not be fixed, the reason is within the fix error.
+	FixFailed = "FAILED"
+)
+
+// VerifyOptions are the options used to verify a download directory.
+type VerifyOptions struct {
+	// The download directory to verify.
+	Directory string
+	// The reports of previous runs, used as the history of what was downloaded
+	// into the directory and where each image was downloaded from.
+	Reports []string
+	// If the problems should be fixed, downloading the broken and missing images
+	// again when their link is known from the reports and otherwise removing them.
+	// Stale partial downloads and orphaned thumbnails are removed.
+	Fix bool
+	// The http client used to download images again, a default client when nil.
+	HTTPClient *http.Client
+}
+
+// BrokenFile is a problem found with a file within a download directory, e.g a
+// empty or truncated image or a html error page saved by a old version.
+type BrokenFile struct {
+	// The path of the file.
+	Path string `json:"path"`
+	// The problem with the file, e.g BROKEN or MISSING.
+	Problem string `json:"problem"`
+	// The reason the file is broken.
+	Reason string `json:"reason"`
+	// The link the image was downloaded from, when known from the reports.
+	Link string `json:"link,omitempty"`
+	// How the problem was fixed when fixing, e.g DOWNLOADED or REMOVED.
+	Fix string `json:"fix,omitempty"`
+	// The reason the problem could not be fixed.
+	FixError string `json:"fixError,omitempty"`
+}
+
+// Verify walks the given download directory checking every image decodes and
+// every video container is complete, along with finding partial downloads that
+// cannot be resumed and thumbnails of images that no longer exist. The images
+// the reports record as downloaded are checked to still exist. Problems are
+// fixed when asked to, and are returned sorted by path.
+func Verify(ctx context.Context, options VerifyOptions) ([]BrokenFile, error) {
+	history, err := loadHistory(options.Directory, options.Reports)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var problems []BrokenFile
+	seen := map[string]bool{}
+
+	err = filepath.WalkDir(options.Directory, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			if path == filepath.Join(options.Directory, thumbnail.Directory) {
+				problems = append(problems, orphanedThumbnails(options.Directory, path)...)
+				return filepath.SkipDir
+			}
+
+			if path != options.Directory && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		if problem, ok := stalePartial(path); ok {
+			problems = append(problems, problem)
+			return nil
+		}
+
+		if !mediaExtensions[strings.ToLower(filepath.Ext(path))] {
+			return nil
+		}
+
+		abs, _ := filepath.Abs(path)
+		seen[abs] = true
+
+		if reason := verifyFile(path); reason != "" {
+			problems = append(problems, BrokenFile{Path: path, Problem: ProblemBroken, Reason: reason,
+				Link: history[abs].Link})
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	for abs, entry := range history {
+		if _, err := os.Stat(abs); !seen[abs] && os.IsNotExist(err) {
+			problems = append(problems, BrokenFile{Path: entry.Path, Problem: ProblemMissing,
+				Reason: fmt.Sprintf("recorded as %v but does not exist", strings.ToLower(entry.State)), Link: entry.Link})
+		}
+	}
+
+	sort.Slice(problems, func(i, j int) bool { return problems[i].Path < problems[j].Path })
+
+	if options.Fix {
+		client := options.HTTPClient
+
+		if client == nil {
+			if client, err = NewHTTPClient(Options{UserAgent: DefaultUserAgent, ConnectTimeout: 30 * time.Second,
+				ReadTimeout: time.Minute}); err != nil {
+				return nil, err
+			}
+		}
+
+		for i := range problems {
+			if ctx.Err() != nil {
+				return problems, ctx.Err()
+			}
+
+			fixProblem(ctx, client, &problems[i])
+		}
+	}
+
+	return problems, nil
+}
+
+// loadHistory loads the images the reports record as downloaded (or skipped
+// since they already existed) within the directory, keyed by the absolute path.
+// Images written into a archive are not within the directory.
+func loadHistory(dir string, reports []string) (map[string]ReportEntry, error) {
+	history := map[string]ReportEntry{}
+	root, err := filepath.Abs(dir)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, reportPath := range reports {
+		report, err := ReadReport(reportPath)
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, entry := range report.Items {
+			if entry.Path == "" || (entry.State != DownloadState(SUCCESS).String() && entry.State != DownloadState(SKIPPED).String()) {
+				continue
+			}
+
+			if index := strings.LastIndex(entry.Path, ":"); index > 0 && archive.Supported(entry.Path[:index]) {
+				continue
+			}
+
+			abs, err := filepath.Abs(entry.Path)
+
+			if err != nil || !strings.HasPrefix(abs, root+string(filepath.Separator)) {
+				continue
+			}
+
+			history[abs] = entry
+		}
+	}
+
+	return history, nil
+}
+
+// orphanedThumbnails returns the thumbnails within the thumbnail tree of the root
+// directory whose image no longer exists.
+func orphanedThumbnails(root string, thumbnails string) []BrokenFile {
+	var problems []BrokenFile
+
+	_ = filepath.WalkDir(thumbnails, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(thumbnails, path)
+
+		if err != nil {
+			return nil
+		}
+
+		if _, err := os.Stat(filepath.Join(root, strings.TrimSuffix(rel, ".jpg"))); os.IsNotExist(err) {
+			problems = append(problems, BrokenFile{Path: path, Problem: ProblemOrphanedThumbnail,
+				Reason: "the image of the thumbnail does not exist"})
+		}
+
+		return nil
+	})
+
+	return problems
+}
+
+// stalePartial returns the problem of the partial download (or its resume state)
+// at the given path when it cannot be resumed, partial downloads that can be
+// resumed are left for the next run.
+func stalePartial(path string) (BrokenFile, bool) {
+	if strings.HasSuffix(path, partialExtension) {
+		if state, ok := readPartialState(path); !ok || state.validator() == "" {
+			return BrokenFile{Path: path, Problem: ProblemStalePartial,
+				Reason: "partial download that cannot be resumed"}, true
+		}
+
+		return BrokenFile{}, false
+	}
+
+	if strings.HasSuffix(path, partialExtension+partialStateExtension) {
+		if _, err := os.Stat(strings.TrimSuffix(path, partialStateExtension)); os.IsNotExist(err) {
+			return BrokenFile{Path: path, Problem: ProblemStalePartial,
+				Reason: "resume state without a partial download"}, true
+		}
+	}
+
+	return BrokenFile{}, false
+}
+
+// fixProblem fixes the problem, downloading broken and missing images again when
+// the link is known and otherwise removing the file.
+func fixProblem(ctx context.Context, client *http.Client, problem *BrokenFile) {
+	fail := func(err error) {
+		problem.Fix = FixFailed
+		problem.FixError = err.Error()
+	}
+
+	switch {
+	case problem.Problem == ProblemStalePartial && strings.HasSuffix(problem.Path, partialExtension):
+		removePartial(problem.Path)
+		problem.Fix = FixRemoved
+	case problem.Link != "":
+		if err := os.Remove(problem.Path); err != nil && !os.IsNotExist(err) {
+			fail(err)
+			return
+		}
+
+		_ = os.MkdirAll(filepath.Dir(problem.Path), os.ModePerm)
+		policy := RetryPolicy{MaxAttempts: 3, BaseDelay: time.Second, MaxDelay: time.Minute}
+
+		if err := policy.do(ctx, func() error {
+			_, err := downloadToFile(ctx, client, problem.Path, problem.Link)
+			return err
+		}); err != nil {
+			fail(err)
+			return
+		}
+
+		if reason := verifyFile(problem.Path); reason != "" {
+			fail(fmt.Errorf("downloaded again but is still broken: %v", reason))
+			return
+		}
+
+		problem.Fix = FixDownloaded
+	case problem.Problem == ProblemMissing:
+		fail(fmt.Errorf("the link the image was downloaded from is not known"))
+	default:
+		if err := os.Remove(problem.Path); err != nil && !os.IsNotExist(err) {
+			fail(err)
+			return
+		}
+
+		problem.Fix = FixRemoved
+	}
+}
+
+// verifyFile returns the reason the image or video at the given path is broken,
+// empty when the file is valid. Images are decoded in full, catching truncated
+// images, while videos have their container structure checked.
+func verifyFile(path string) string {
+	file, err := os.Open(path)
+
+	if err != nil {
+		return err.Error()
+	}
+
+	defer file.Close()
+
+	info, err := file.Stat()
+
+	if err != nil {
+		return err.Error()
+	}
+
+	header := make([]byte, 512)
+	n, err := io.ReadFull(file, header)
+
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return err.Error()
+	}
+
+	if n == 0 {
+		return "empty file"
+	}
+
+	if !isMediaContent(header[:n]) {
+		return "not a image or video"
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return err.Error()
+	}
+
+	contentType := http.DetectContentType(header[:n])
+
+	switch {
+	case n >= 8 && string(header[4:8]) == "ftyp":
+		if err := verifyMP4(file, info.Size()); err != nil {
+			return fmt.Sprintf("corrupt video: %v", err)
+		}
+	case strings.HasPrefix(contentType, "image/"):
+		if _, _, err := image.Decode(file); err != nil {
+			return fmt.Sprintf("corrupt image: %v", err)
+		}
+	}
+
+	return ""
+}
+
+// verifyMP4 walks the top level boxes of the mp4 container ensuring no box
+// extends past the end of the file (a truncated download) and the movie box
+// describing the video exists.
+func verifyMP4(file io.ReadSeeker, size int64) error {
+	var offset int64
+	hasMovie := false
+
+	for offset < size {
+		if _, err := file.Seek(offset, io.SeekStart); err != nil {
+			return err
+		}
+
+		header := make([]byte, 16)
+
+		if _, err := io.ReadFull(file, header[:8]); err != nil {
+			return fmt.Errorf("truncated box header at %v", offset)
+		}
+
+		boxSize := int64(binary.BigEndian.Uint32(header[:4]))
+		boxType := string(header[4:8])
+
+		switch boxSize {
+		case 0:
+			// the box extends to the end of the file.
+			boxSize = size - offset
+		case 1:
+			if _, err := io.ReadFull(file, header[8:16]); err != nil {
+				return fmt.Errorf("truncated box header at %v", offset)
+			}
+
+			boxSize = int64(binary.BigEndian.Uint64(header[8:16]))
+		}
+
+		if boxSize < 8 {
+			return fmt.Errorf("invalid %v box size %v", boxType, boxSize)
+		}
+
+		if offset+boxSize > size {
+			return fmt.Errorf("%v box extends past the end of the file", boxType)
+		}
+
+		if boxType == "moov" {
+			hasMovie = true
+		}
+
+		offset += boxSize
+	}
+
+	if !hasMovie {
+		return fmt.Errorf("missing moov box")
+	}
+
+	return nil
+}
@@ -0,0 +1,150 @@
+package scraper
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// encodeImage encodes a small image with the given encoder.
+func encodeImage(t *testing.T, encode func(*bytes.Buffer, image.Image) error) []byte {
+	var buffer bytes.Buffer
+	require.NoError(t, encode(&buffer, image.NewRGBA(image.Rect(0, 0, 32, 32))))
+	return buffer.Bytes()
+}
+
+// mp4Box encodes a mp4 box of the given type and declared size, containing the
+// given content.
+func mp4Box(typ string, size uint32, content []byte) []byte {
+	box := make([]byte, 8)
+	binary.BigEndian.PutUint32(box, size)
+	copy(box[4:], typ)
+	return append(box, content...)
+}
+
+// TestVerify ensures broken images and videos, stale partial downloads, orphaned
+// thumbnails and images missing from the history of the reports are found, and
+// that fixing downloads the images again when the link is known.
+func TestVerify(t *testing.T) {
+	validJPEG := encodeImage(t, func(w *bytes.Buffer, img image.Image) error { return jpeg.Encode(w, img, nil) })
+	validPNG := encodeImage(t, func(w *bytes.Buffer, img image.Image) error { return png.Encode(w, img) })
+
+	ftyp := mp4Box("ftyp", 16, []byte("isom\x00\x00\x02\x00"))
+	validMP4 := append(append(append([]byte{}, ftyp...), mp4Box("moov", 8, nil)...), mp4Box("mdat", 12, []byte("data"))...)
+	truncatedMP4 := append(append([]byte{}, ftyp...), mp4Box("mdat", 1000, []byte("data"))...)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/jpeg")
+		_, _ = w.Write(validJPEG)
+	}))
+
+	defer server.Close()
+
+	dir := t.TempDir()
+
+	files := map[string][]byte{
+		"cute/valid.jpg":               validJPEG,
+		"cute/valid.png":               validPNG,
+		"cute/valid.mp4":               validMP4,
+		"cute/truncated.jpg":           validJPEG[:len(validJPEG)/2],
+		"cute/truncated.mp4":           truncatedMP4,
+		"cute/empty.jpg":               {},
+		"cute/html.png":                []byte("<html><body>not found</body></html>"),
+		"cute/notes.txt":               []byte("not media"),
+		"cute/stale.jpg.part":          []byte("partial"),
+		"cute/resumable.jpg.part":      []byte("partial"),
+		"cute/resumable.jpg.part.json": []byte(`{"link": "https://i.redd.it/resumable.jpg", "etag": "\"abc\""}`),
+		"cute/orphan.jpg.part.json":    []byte(`{"link": "https://i.redd.it/orphan.jpg"}`),
+		".thumbs/cute/valid.jpg.jpg":   validJPEG,
+		".thumbs/cute/gone.jpg.jpg":    validJPEG,
+		".hidden/html.jpg":             []byte("<html></html>"),
+	}
+
+	for name, content := range files {
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), content, 0644))
+	}
+
+	var report Report
+	report.Items = []ReportEntry{
+		{State: "SUCCESS", Link: server.URL + "/truncated.jpg", Path: filepath.Join(dir, "cute", "truncated.jpg")},
+		{State: "SKIPPED", Link: server.URL + "/missing.jpg", Path: filepath.Join(dir, "cute", "missing.jpg")},
+		{State: "FAILED", Link: server.URL + "/failed.jpg", Path: filepath.Join(dir, "cute", "failed.jpg")},
+		{State: "SUCCESS", Link: server.URL + "/archived.jpg", Path: filepath.Join(dir, "out.zip") + ":cute/archived.jpg"},
+	}
+
+	reportPath := filepath.Join(t.TempDir(), "report.json")
+	require.NoError(t, report.Write(reportPath))
+
+	options := VerifyOptions{Directory: dir, Reports: []string{reportPath}}
+	problems, err := Verify(context.Background(), options)
+	require.NoError(t, err)
+
+	type found struct{ path, problem, link string }
+	var actual []found
+
+	for _, problem := range problems {
+		rel, _ := filepath.Rel(dir, problem.Path)
+		actual = append(actual, found{filepath.ToSlash(rel), problem.Problem, problem.Link})
+		assert.NotEmpty(t, problem.Reason, problem.Path)
+		assert.Empty(t, problem.Fix, problem.Path)
+	}
+
+	assert.Equal(t, []found{
+		{".thumbs/cute/gone.jpg.jpg", ProblemOrphanedThumbnail, ""},
+		{"cute/empty.jpg", ProblemBroken, ""},
+		{"cute/html.png", ProblemBroken, ""},
+		{"cute/missing.jpg", ProblemMissing, server.URL + "/missing.jpg"},
+		{"cute/orphan.jpg.part.json", ProblemStalePartial, ""},
+		{"cute/stale.jpg.part", ProblemStalePartial, ""},
+		{"cute/truncated.jpg", ProblemBroken, server.URL + "/truncated.jpg"},
+		{"cute/truncated.mp4", ProblemBroken, ""},
+	}, actual)
+
+	options.Fix = true
+	problems, err = Verify(context.Background(), options)
+	require.NoError(t, err)
+
+	fixes := map[string]string{}
+
+	for _, problem := range problems {
+		rel, _ := filepath.Rel(dir, problem.Path)
+		fixes[filepath.ToSlash(rel)] = problem.Fix
+		assert.Empty(t, problem.FixError, problem.Path)
+	}
+
+	assert.Equal(t, map[string]string{
+		".thumbs/cute/gone.jpg.jpg": FixRemoved,
+		"cute/empty.jpg":            FixRemoved,
+		"cute/html.png":             FixRemoved,
+		"cute/missing.jpg":          FixDownloaded,
+		"cute/orphan.jpg.part.json": FixRemoved,
+		"cute/stale.jpg.part":       FixRemoved,
+		"cute/truncated.jpg":        FixDownloaded,
+		"cute/truncated.mp4":        FixRemoved,
+	}, fixes)
+
+	downloaded, err := os.ReadFile(filepath.Join(dir, "cute", "missing.jpg"))
+	require.NoError(t, err)
+	assert.Equal(t, validJPEG, downloaded)
+	assert.FileExists(t, filepath.Join(dir, "cute", "resumable.jpg.part"))
+
+	// once fixed, nothing is left to be fixed.
+	problems, err = Verify(context.Background(), options)
+	require.NoError(t, err)
+	assert.Empty(t, problems)
+
+	_, err = Verify(context.Background(), VerifyOptions{Directory: filepath.Join(dir, "missing")})
+	assert.Error(t, err)
+}
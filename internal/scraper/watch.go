@@ -0,0 +1,329 @@
+package scraper
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/stephensli/mavic/internal/reddit"
+)
+
+// DefaultWatchInterval is how often each target is polled when watching and no
+// interval was given.
+const DefaultWatchInterval = 5 * time.Minute
+
+// watchStateFile is the file within the output directory the last seen post of
+// every target is remembered in, so a restarted watch only downloads the posts
+// it has not already seen.
+const watchStateFile = ".mavic-watch.json"
+
+// maxWatchAttempts is how many polls a image that failed to download is queued
+// again for before it is given up on, a image that keeps failing (e.g the host
+// is forbidding the download) would otherwise be queued again forever.
+const maxWatchAttempts = 5
+
+// watchState is the last seen post of every watched target, along with the images
+// that failed to download, persisted after every poll. A single state is shared by
+// all the watched targets.
+type watchState struct {
+	mutex sync.Mutex
+	// the path the state is persisted to.
+	path string
+	// the id of the newest post seen of each target, keyed by the watchKey of
+	// the target.
+	LastSeen map[string]string `json:"lastSeen"`
+	// the images of each target that failed to download, queued again on the
+	// next poll, keyed by the watchKey of the target.
+	Failed map[string][]failedImage `json:"failed,omitempty"`
+}
+
+// failedImage is a image that failed to download when watching.
+type failedImage struct {
+	Image reddit.Image `json:"image"`
+	// the number of polls the image has failed to download on.
+	Attempts int `json:"attempts"`
+}
+
+// loadWatchState loads the watch state at the given path, a missing or invalid
+// state starts watching from scratch.
+func loadWatchState(path string) *watchState {
+	state := &watchState{path: path}
+
+	if data, err := os.ReadFile(path); err == nil {
+		_ = json.Unmarshal(data, state)
+	}
+
+	if state.LastSeen == nil {
+		state.LastSeen = map[string]string{}
+	}
+
+	if state.Failed == nil {
+		state.Failed = map[string][]failedImage{}
+	}
+
+	return state
+}
+
+func (w *watchState) get(name string) string {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	return w.LastSeen[name]
+}
+
+func (w *watchState) failed(name string) []failedImage {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	return append([]failedImage{}, w.Failed[name]...)
+}
+
+// set updates the last seen post and the failed images of the target and persists
+// the state, writing to a temporary file first so a interrupted write never loses
+// the state. A empty id keeps the last seen post.
+func (w *watchState) set(name string, id string, failed []failedImage) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if id != "" {
+		w.LastSeen[name] = id
+	}
+
+	if len(failed) > 0 {
+		w.Failed[name] = failed
+	} else {
+		delete(w.Failed, name)
+	}
+
+	data, err := json.MarshalIndent(w, "", "  ")
+
+	if err != nil {
+		return err
+	}
+
+	temp := w.path + ".tmp"
+
+	if err := os.WriteFile(temp, data, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(temp, w.path)
+}
+
+// watchKey is the key of the target within the watch state, the name of the target
+// along with the folder when one was given, since the same sub reddit can be
+// watched into more than one folder.
+func watchKey(target Target) string {
+	if target.Folder != "" {
+		return target.Name + ":" + target.Folder
+	}
+
+	return target.Name
+}
+
+// newPosts returns the posts of the listing that are newer than the last seen
+// post, the listing being sorted from newest to oldest. When the last seen post
+// is not within the listing (e.g it was removed, or more posts than the limit
+// were made since) every post is new.
+func newPosts(listings reddit.Listings, lastSeen string) reddit.Listings {
+	if listings.Data == nil {
+		return listings
+	}
+
+	for i, child := range listings.Data.Children {
+		if child.Data != nil && child.Data.ID != nil && *child.Data.ID == lastSeen {
+			return reddit.Listings{Data: &reddit.ListingData{Children: listings.Data.Children[:i]}}
+		}
+	}
+
+	return listings
+}
+
+// Watch keeps running until the context is cancelled, polling each target on its
+// own interval (the given interval unless the target has one) for new posts and downloading only the posts that have not been
+// seen before. Images that fail to download are downloaded again on the following
+// polls. Sub reddits are polled using the new listing. A failed poll is
+// logged and tried again on the next interval, while a sub reddit that is no
+// longer available stops being watched. The context error is always returned.
+func (s Scraper) Watch(ctx context.Context, interval time.Duration) error {
+	if s.scrapingOptions.ArchivePath != "" {
+		return ErrWatchArchive
+	}
+
+	if interval <= 0 {
+		interval = DefaultWatchInterval
+	}
+
+	if err := os.MkdirAll(s.scrapingOptions.OutputDirectory, os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	state := loadWatchState(filepath.Join(s.scrapingOptions.OutputDirectory, watchStateFile))
+	imageStream := make(chan queuedImage)
+
+	var wg sync.WaitGroup
+
+	for _, target := range s.targets {
+		dir := path.Join(s.scrapingOptions.OutputDirectory, s.targetFolder(target))
+		_ = os.MkdirAll(dir, os.ModePerm)
+		removeStalePartials(dir)
+
+		wg.Add(1)
+
+		go func(target Target) {
+			defer wg.Done()
+			s.watchTarget(ctx, target, interval, state, imageStream)
+		}(target)
+	}
+
+	go func() {
+		wg.Wait()
+		close(imageStream)
+	}()
+
+	for msg := range s.downloadImages(ctx, imageStream) {
+		s.recordState(msg)
+	}
+
+	return ctx.Err()
+}
+
+// watchTarget polls the target every interval until the context is cancelled or
+// the target is no longer available.
+func (s Scraper) watchTarget(ctx context.Context, target Target, interval time.Duration, state *watchState,
+	imageStream chan<- queuedImage) {
+	// the saved and upvoted posts are already sorted by when they were saved.
+	if target.Name != savedTarget && target.Name != upvotedTarget {
+		target.PageType = "new"
+	}
+
+	// each target can be polled on its own interval.
+	if target.Interval > 0 {
+		interval = target.Interval
+	}
+
+	for {
+		if err := s.pollTarget(ctx, target, state, imageStream); err != nil {
+			var targetErr *TargetError
+
+			if errors.As(err, &targetErr) && targetErr.State() != "FAILED" {
+				s.logger.Warn("no longer watching subreddit", "subreddit", target.Name, "state", targetErr.State(),
+					"error", targetErr.Err)
+				return
+			}
+
+			s.logger.Error("failed to poll subreddit", "subreddit", target.Name, "retryIn", interval, "error", err)
+		}
+
+		if sleepContext(ctx, interval) != nil {
+			return
+		}
+	}
+}
+
+// pollTarget downloads the new posts of the target since it was last polled, along
+// with the images that failed to download on the previous polls. The newest post
+// is only remembered once every queued image has finished downloading, while the
+// images that failed are remembered to be queued again on the next poll. A poll
+// that is interrupted remembers nothing, so the posts are polled again.
+func (s Scraper) pollTarget(ctx context.Context, target Target, state *watchState,
+	imageStream chan<- queuedImage) error {
+	key := watchKey(target)
+	listings, err := s.gatherRedditFeed(ctx, target)
+
+	if ctx.Err() != nil {
+		return nil
+	}
+
+	if err != nil {
+		return &TargetError{Target: target.Name, Err: err}
+	}
+
+	links := parseLinksFromListings(newPosts(listings, state.get(key)))
+
+	if len(links) > target.Limit {
+		links = links[:target.Limit]
+	}
+
+	s.logger.Debug("polled subreddit", "subreddit", target.Name, "images", len(links))
+	s.metrics.listingFetched(target.Name)
+
+	// the previously failed images are queued first, along with the number of
+	// polls they have failed on, unless they have come up within the listing again.
+	queued := map[string]failedImage{}
+	var images []reddit.Image
+
+	for _, failed := range state.failed(key) {
+		queued[failed.Image.Id] = failed
+		images = append(images, failed.Image)
+	}
+
+	for _, image := range links {
+		if _, ok := queued[image.Id]; !ok {
+			queued[image.Id] = failedImage{Image: image}
+			images = append(images, image)
+		}
+	}
+
+	folder := s.targetFolder(target)
+	outcomes := make(chan updateState, len(images))
+
+	for _, image := range images {
+		select {
+		case <-ctx.Done():
+			return nil
+		case imageStream <- queuedImage{image: image, folder: folder, done: outcomes}:
+		}
+	}
+
+	var failed []failedImage
+
+	for range images {
+		var msg updateState
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case msg = <-outcomes:
+		}
+
+		if msg.state != FAILED {
+			continue
+		}
+
+		// the image is found by the post id, the link of the outcome being the
+		// preferred link over the link of the post.
+		image := queued[msg.image.Id]
+		image.Attempts += 1
+
+		if image.Attempts >= maxWatchAttempts {
+			s.logger.Warn("giving up on image", "subreddit", image.Image.Subreddit, "id", image.Image.Id,
+				"link", image.Image.Link, "attempts", image.Attempts, "reason", msg.reason)
+			continue
+		}
+
+		failed = append(failed, image)
+	}
+
+	// a download cancelled part way through fails, but is not a failure of
+	// the image, so nothing is remembered.
+	if ctx.Err() != nil {
+		return nil
+	}
+
+	newest := ""
+
+	if listings.Data != nil && len(listings.Data.Children) > 0 {
+		if child := listings.Data.Children[0].Data; child != nil && child.ID != nil {
+			newest = *child.ID
+		}
+	}
+
+	return state.set(key, newest, failed)
+}
@@ -0,0 +1,281 @@
+package scraper
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stephensli/mavic/internal/reddit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func watchPost(server string, id string) string {
+	return fmt.Sprintf(`{"kind": "t3", "data": {"id": "%[2]v", "post_hint": "image", "url": "%[1]v/images/%[2]v.jpg",
+		"domain": "i.redd.it", "author": "user", "permalink": "/r/cute/comments/%[2]v/", "title": "%[2]v", "subreddit": "cute"}}`,
+		server, id)
+}
+
+// TestNewPosts ensures only the posts newer than the last seen post are taken,
+// and every post when the last seen post is not within the listing.
+func TestNewPosts(t *testing.T) {
+	ids := func(listings reddit.Listings) []string {
+		var result []string
+
+		for _, child := range listings.Data.Children {
+			result = append(result, *child.Data.ID)
+		}
+
+		return result
+	}
+
+	listings, err := reddit.UnmarshalListing([]byte(`{"kind": "Listing", "data": {"children": [
+		{"kind": "t3", "data": {"id": "c"}}, {"kind": "t3", "data": {"id": "b"}}, {"kind": "t3", "data": {"id": "a"}}]}}`))
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"c", "b"}, ids(newPosts(listings, "a")))
+	assert.Empty(t, ids(newPosts(listings, "c")))
+	assert.Equal(t, []string{"c", "b", "a"}, ids(newPosts(listings, "")))
+	assert.Equal(t, []string{"c", "b", "a"}, ids(newPosts(listings, "removed")))
+}
+
+// TestWatch ensures each target is polled using the new listing, a failed poll does
+// not stop watching, only new posts are downloaded and a sub reddit that no longer
+// exists stops being polled.
+func TestWatch(t *testing.T) {
+	var mutex sync.Mutex
+	var polls, missingPolls int
+	var downloads []string
+
+	server := httptest.NewUnstartedServer(nil)
+	url := "http://" + server.Listener.Addr().String()
+
+	server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		switch r.URL.Path {
+		case "/r/cute/new.json":
+			polls += 1
+
+			switch polls {
+			case 1:
+				w.WriteHeader(http.StatusInternalServerError)
+			case 2:
+				_, _ = fmt.Fprintf(w, `{"kind": "Listing", "data": {"children": [%v]}}`, watchPost(url, "a"))
+			default:
+				_, _ = fmt.Fprintf(w, `{"kind": "Listing", "data": {"children": [%v, %v]}}`,
+					watchPost(url, "b"), watchPost(url, "a"))
+			}
+		case "/r/missing/new.json":
+			missingPolls += 1
+			w.WriteHeader(http.StatusNotFound)
+		case "/images/a.jpg", "/images/b.jpg":
+			downloads = append(downloads, r.URL.Path)
+			_, _ = w.Write(sampleJPEG)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	server.Start()
+	defer server.Close()
+
+	dir := t.TempDir()
+	s, err := NewScraper(Options{PageType: "hot", ImageLimit: 10, OutputDirectory: dir,
+		Subreddits: []string{"cute", "missing"}})
+	require.NoError(t, err)
+	s.baseUrl = url
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan error)
+	go func() { done <- s.Watch(ctx, 10*time.Millisecond) }()
+
+	require.Eventually(t, func() bool {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return polls >= 5
+	}, 5*time.Second, 10*time.Millisecond)
+
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+
+	assert.Equal(t, []string{"/images/a.jpg", "/images/b.jpg"}, downloads)
+	assert.Equal(t, 1, missingPolls)
+	assert.FileExists(t, filepath.Join(dir, "cute", "a.jpg"))
+	assert.FileExists(t, filepath.Join(dir, "cute", "b.jpg"))
+
+	// the last seen post is remembered, so a restarted watch only downloads new posts.
+	state := loadWatchState(filepath.Join(dir, watchStateFile))
+	assert.Equal(t, "b", state.get("cute"))
+
+	_, err = os.Stat(filepath.Join(dir, watchStateFile+".tmp"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+// TestWatchRetriesFailed ensures a image that failed to download is remembered and
+// downloaded again on the next poll, even though the post is no longer new.
+func TestWatchRetriesFailed(t *testing.T) {
+	var mutex sync.Mutex
+	var polls, downloads int
+
+	server := httptest.NewUnstartedServer(nil)
+	url := "http://" + server.Listener.Addr().String()
+
+	server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		switch r.URL.Path {
+		case "/r/cute/new.json":
+			polls += 1
+			_, _ = fmt.Fprintf(w, `{"kind": "Listing", "data": {"children": [%v]}}`, watchPost(url, "a"))
+		case "/images/a.jpg":
+			// the first download fails, as if the host was briefly down.
+			if downloads += 1; downloads == 1 {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+
+			_, _ = w.Write(sampleJPEG)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	server.Start()
+	defer server.Close()
+
+	dir := t.TempDir()
+	s, err := NewScraper(Options{PageType: "hot", ImageLimit: 10, OutputDirectory: dir, Subreddits: []string{"cute"}})
+	require.NoError(t, err)
+	s.baseUrl = url
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan error)
+	go func() { done <- s.Watch(ctx, 10*time.Millisecond) }()
+
+	require.Eventually(t, func() bool {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return polls >= 3
+	}, 5*time.Second, 10*time.Millisecond)
+
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+
+	assert.Equal(t, 2, downloads)
+	assert.FileExists(t, filepath.Join(dir, "cute", "a.jpg"))
+
+	state := loadWatchState(filepath.Join(dir, watchStateFile))
+	assert.Equal(t, "a", state.get("cute"))
+	assert.Empty(t, state.failed("cute"))
+}
+
+// TestWatchGivesUp ensures a image that keeps failing is only queued again until
+// the max number of attempts is reached.
+func TestWatchGivesUp(t *testing.T) {
+	var mutex sync.Mutex
+	var polls, downloads int
+
+	server := httptest.NewUnstartedServer(nil)
+	url := "http://" + server.Listener.Addr().String()
+
+	server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		switch r.URL.Path {
+		case "/r/cute/new.json":
+			polls += 1
+			_, _ = fmt.Fprintf(w, `{"kind": "Listing", "data": {"children": [%v]}}`, watchPost(url, "a"))
+		default:
+			downloads += 1
+			w.WriteHeader(http.StatusForbidden)
+		}
+	})
+
+	server.Start()
+	defer server.Close()
+
+	dir := t.TempDir()
+	s, err := NewScraper(Options{PageType: "hot", ImageLimit: 10, OutputDirectory: dir, Subreddits: []string{"cute"}})
+	require.NoError(t, err)
+	s.baseUrl = url
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan error)
+	go func() { done <- s.Watch(ctx, 10*time.Millisecond) }()
+
+	require.Eventually(t, func() bool {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return polls >= maxWatchAttempts+2
+	}, 5*time.Second, 10*time.Millisecond)
+
+	cancel()
+	<-done
+
+	assert.Equal(t, maxWatchAttempts, downloads)
+	assert.Empty(t, loadWatchState(filepath.Join(dir, watchStateFile)).failed("cute"))
+}
+
+// TestWatchTargetInterval ensures each target is polled on its own interval,
+// falling back to the watch interval.
+func TestWatchTargetInterval(t *testing.T) {
+	var mutex sync.Mutex
+	polls := map[string]int{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		polls[r.URL.Path] += 1
+		_, _ = w.Write([]byte(`{"kind": "Listing", "data": {"children": []}}`))
+	}))
+
+	defer server.Close()
+
+	s, err := NewScraper(Options{PageType: "hot", ImageLimit: 10, OutputDirectory: t.TempDir(),
+		Subreddits: []string{"cute@10ms", "pics"}})
+	require.NoError(t, err)
+	s.baseUrl = server.URL
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan error)
+	go func() { done <- s.Watch(ctx, time.Hour) }()
+
+	require.Eventually(t, func() bool {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return polls["/r/cute/new.json"] >= 3
+	}, 5*time.Second, 10*time.Millisecond)
+
+	cancel()
+	<-done
+
+	assert.Equal(t, 1, polls["/r/pics/new.json"])
+}
+
+// TestWatchArchive ensures watching cannot write into a archive.
+func TestWatchArchive(t *testing.T) {
+	s, err := NewScraper(Options{PageType: "hot", Subreddits: []string{"cute"},
+		ArchivePath: filepath.Join(t.TempDir(), "cute.zip")})
+	require.NoError(t, err)
+
+	assert.ErrorIs(t, s.Watch(context.Background(), time.Second), ErrWatchArchive)
+}
@@ -0,0 +1,120 @@
+package thumbnail
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"strings"
+
+	// registering the decoders for the supported source formats, only the first
+	// frame of a animated gif is used.
+	_ "image/gif"
+	_ "image/png"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// Directory is the name of the hidden folder within the download directory that
+// holds the thumbnail tree, mirroring the layout of the downloaded images.
+const Directory = ".thumbs"
+
+// ErrUnsupportedFormat is returned when the given file is not a image that can be
+// decoded (e.g mp4), callers are expected to treat this as a non-fatal outcome.
+var ErrUnsupportedFormat = errors.New("thumbnail: unsupported file format")
+
+// supportedExtensions are the image formats that thumbnails can be generated for.
+var supportedExtensions = map[string]bool{".jpg": true, ".jpeg": true, ".png": true, ".gif": true, ".webp": true}
+
+// Path returns the location of the thumbnail for the image at the given path. The
+// thumbnail keeps the full file name of the image with a jpg extension appended,
+// so images with the same id but different formats don't collide.
+func Path(root string, imagePath string) (string, error) {
+	rel, err := filepath.Rel(root, imagePath)
+
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(root, Directory, rel+".jpg"), nil
+}
+
+// Generate creates a jpeg thumbnail for the image at the given path within the
+// thumbnail tree of the root directory. The image is scaled down to fit within
+// the max dimension, keeping its aspect ratio, and is never scaled up.
+func Generate(root string, imagePath string, maxDimension int) error {
+	if !supportedExtensions[strings.ToLower(filepath.Ext(imagePath))] {
+		return ErrUnsupportedFormat
+	}
+
+	in, err := os.Open(imagePath)
+
+	if err != nil {
+		return err
+	}
+
+	defer in.Close()
+	src, _, err := image.Decode(in)
+
+	if err != nil {
+		return err
+	}
+
+	thumbPath, err := Path(root, imagePath)
+
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(thumbPath), os.ModePerm); err != nil {
+		return err
+	}
+
+	out, err := os.Create(thumbPath)
+
+	if err != nil {
+		return err
+	}
+
+	if err := jpeg.Encode(out, Scale(src, maxDimension), &jpeg.Options{Quality: 80}); err != nil {
+		_ = out.Close()
+		_ = os.Remove(thumbPath)
+		return err
+	}
+
+	return out.Close()
+}
+
+// Scale scales the image down to fit within the max dimension. Transparent areas
+// are flattened onto a white background since the thumbnail is a jpeg.
+func Scale(src image.Image, maxDimension int) image.Image {
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	if maxDimension > 0 && (width > maxDimension || height > maxDimension) {
+		if width >= height {
+			height = max(1, height*maxDimension/width)
+			width = maxDimension
+		} else {
+			width = max(1, width*maxDimension/height)
+			height = maxDimension
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, bounds, draw.Over, nil)
+
+	return dst
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+
+	return b
+}
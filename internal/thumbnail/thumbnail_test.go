@@ -0,0 +1,75 @@
+package thumbnail
+
+import (
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestScale ensures images are scaled to fit within the max dimension while
+// keeping the aspect ratio and that small images are never scaled up.
+func TestScale(t *testing.T) {
+	tests := []struct {
+		width, height, max int
+		expected           image.Point
+	}{
+		{400, 200, 100, image.Pt(100, 50)},
+		{200, 400, 100, image.Pt(50, 100)},
+		{100, 100, 100, image.Pt(100, 100)},
+		{50, 20, 100, image.Pt(50, 20)},
+		{1000, 1, 100, image.Pt(100, 1)},
+	}
+
+	for _, test := range tests {
+		scaled := Scale(image.NewRGBA(image.Rect(0, 0, test.width, test.height)), test.max)
+		assert.Equal(t, test.expected, scaled.Bounds().Size())
+	}
+}
+
+// TestGenerate ensures thumbnails are written into the parallel thumbnail tree
+// for each of the supported formats and that videos are rejected.
+func TestGenerate(t *testing.T) {
+	root := t.TempDir()
+	src := image.NewPaletted(image.Rect(0, 0, 300, 150), []color.Color{color.Black, color.White})
+
+	encoders := map[string]func(f *os.File) error{
+		"a.png": func(f *os.File) error { return png.Encode(f, src) },
+		"a.jpg": func(f *os.File) error { return jpeg.Encode(f, src, nil) },
+		"a.gif": func(f *os.File) error { return gif.Encode(f, src, nil) },
+	}
+
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "cute"), os.ModePerm))
+
+	for name, encode := range encoders {
+		imagePath := filepath.Join(root, "cute", name)
+		f, err := os.Create(imagePath)
+		require.NoError(t, err)
+		require.NoError(t, encode(f))
+		require.NoError(t, f.Close())
+
+		require.NoError(t, Generate(root, imagePath, 100))
+
+		thumbPath, err := Path(root, imagePath)
+		require.NoError(t, err)
+		assert.Equal(t, filepath.Join(root, Directory, "cute", name+".jpg"), thumbPath)
+
+		thumb, err := os.Open(thumbPath)
+		require.NoError(t, err)
+		config, err := jpeg.DecodeConfig(thumb)
+		require.NoError(t, err)
+		_ = thumb.Close()
+
+		assert.Equal(t, 100, config.Width)
+		assert.Equal(t, 50, config.Height)
+	}
+
+	assert.ErrorIs(t, Generate(root, filepath.Join(root, "cute", "a.mp4"), 100), ErrUnsupportedFormat)
+}
@@ -0,0 +1,10 @@
+package web
+
+import "embed"
+
+// Files contains the server side templates and static web assets, embedded so
+// generated output (e.g the gallery) is self-contained and does not depend on
+// the source tree being available at runtime.
+//
+//go:embed template static
+var Files embed.FS